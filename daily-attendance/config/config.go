@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	apiManager "github.com/TheKrainBow/go-api"
 	"gopkg.in/yaml.v2"
@@ -11,9 +14,23 @@ const AccessControl string = "access-control"
 const FTv2 string = "42-v2"
 const FTAttendance string = "42-attendance"
 
+const defaultAttendanceSource string = "access-control"
+
+// Values of 42Attendance.postStrategy
+const (
+	PostStrategySegments string = "segments" // One attendance per presence segment, the default
+	PostStrategySpan     string = "span"     // One attendance per watch period, from first to last badge usage
+)
+
 var ConfigData configFile
 
 type configFile struct {
+	Campus struct {
+		ID               int            `yaml:"id"`
+		Timezone         string         `yaml:"timezone"`         // IANA name, like Europe/Paris
+		AttendanceSource string         `yaml:"attendanceSource"` // Source of the attendances posted to Chronos
+		Location         *time.Location `yaml:"-"`                // Loaded from Timezone
+	} `yaml:"campus"`
 	AccessControl struct {
 		Endpoint string `yaml:"endpoint"`
 		TestPath string `yaml:"testpath"`
@@ -27,19 +44,39 @@ type configFile struct {
 		Uid                string   `yaml:"uid"`
 		Secret             string   `yaml:"secret"`
 		Scope              string   `yaml:"scope"`
-		CampusID           string   `yaml:"campusId"`
+		CampusID           string   `yaml:"campusId"` // Deprecated, use campus.id
 		ApprenticeProjects []string `yaml:"apprenticeProjects"`
 	} `yaml:"42apiV2"`
 	Attendance42 struct {
-		AutoPost bool   `yaml:"autoPost"`
-		TokenUrl string `yaml:"tokenUrl"`
-		Endpoint string `yaml:"endpoint"`
-		TestPath string `yaml:"testpath"`
-		Uid      string `yaml:"uid"`
-		Secret   string `yaml:"secret"`
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
+		AutoPost     bool   `yaml:"autoPost"`
+		PostStrategy string `yaml:"postStrategy"`
+		TokenUrl     string `yaml:"tokenUrl"`
+		Endpoint     string `yaml:"endpoint"`
+		TestPath     string `yaml:"testpath"`
+		Uid          string `yaml:"uid"`
+		Secret       string `yaml:"secret"`
+		Username     string `yaml:"username"`
+		Password     string `yaml:"password"`
 	} `yaml:"42Attendance"`
+	Ledger struct {
+		Path          string `yaml:"path"`
+		CheckChronos  bool   `yaml:"checkChronos"`
+		RetentionDays int    `yaml:"retentionDays"` // Posted attendances older than this are forgotten, 0 keeps them all
+	} `yaml:"ledger"`
+	Watchtime struct {
+		Monday    [][]string `yaml:"monday"`
+		Tuesday   [][]string `yaml:"tuesday"`
+		Wednesday [][]string `yaml:"wednesday"`
+		Thursday  [][]string `yaml:"thursday"`
+		Friday    [][]string `yaml:"friday"`
+		Saturday  [][]string `yaml:"saturday"`
+		Sunday    [][]string `yaml:"sunday"`
+	} `yaml:"watchtime"`
+	Doors struct {
+		Entry    []string `yaml:"entry"`
+		Exit     []string `yaml:"exit"`
+		Internal []string `yaml:"internal"`
+	} `yaml:"doors"`
 }
 
 func LoadConfig(path string) error {
@@ -55,6 +92,16 @@ func LoadConfig(path string) error {
 		return err
 	}
 
+	err = loadCampus()
+	if err != nil {
+		return err
+	}
+
+	err = loadPostStrategy()
+	if err != nil {
+		return err
+	}
+
 	_, err = apiManager.NewAPIClient(FTv2, apiManager.APIClientInput{
 		AuthType:     apiManager.AuthTypeClientCredentials,
 		TokenURL:     ConfigData.ApiV2.TokenUrl,
@@ -83,3 +130,44 @@ func LoadConfig(path string) error {
 	}
 	return nil
 }
+
+// loadPostStrategy checks 42Attendance.postStrategy, posting presence segments when it isn't set
+func loadPostStrategy() error {
+	switch ConfigData.Attendance42.PostStrategy {
+	case "":
+		ConfigData.Attendance42.PostStrategy = PostStrategySegments
+	case PostStrategySegments, PostStrategySpan:
+	default:
+		return fmt.Errorf("invalid 42Attendance.postStrategy `%s` (%s or %s)", ConfigData.Attendance42.PostStrategy, PostStrategySegments, PostStrategySpan)
+	}
+	return nil
+}
+
+/*
+Check the campus block and load its timezone. Falls back on the old 42apiV2.campusId.
+*/
+func loadCampus() error {
+	campus := &ConfigData.Campus
+	if campus.ID == 0 && ConfigData.ApiV2.CampusID != "" {
+		id, err := strconv.Atoi(ConfigData.ApiV2.CampusID)
+		if err != nil {
+			return fmt.Errorf("invalid 42apiV2.campusId `%s`", ConfigData.ApiV2.CampusID)
+		}
+		campus.ID = id
+	}
+	if campus.ID <= 0 {
+		return fmt.Errorf("campus.id is required")
+	}
+	if campus.Timezone == "" {
+		return fmt.Errorf("campus.timezone is required (IANA name, like Europe/Paris)")
+	}
+	location, err := time.LoadLocation(campus.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid campus.timezone `%s`: %w", campus.Timezone, err)
+	}
+	campus.Location = location
+	if campus.AttendanceSource == "" {
+		campus.AttendanceSource = defaultAttendanceSource
+	}
+	return nil
+}
@@ -4,4 +4,9 @@ go 1.24.4
 
 require gopkg.in/yaml.v2 v2.4.0
 
-require github.com/TheKrainBow/go-api v1.0.5
+require (
+	github.com/TheKrainBow/42-watchdog/ledger v0.0.0
+	github.com/TheKrainBow/go-api v1.0.5
+)
+
+replace github.com/TheKrainBow/42-watchdog/ledger => ../ledger
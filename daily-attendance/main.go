@@ -26,20 +26,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Determine target date
+	// Init
+	err = config.LoadConfig(os.Args[1])
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// Determine target date, days are the ones of the campus
 	var targetDate time.Time
 	if len(os.Args) >= 4 {
-		targetDate, err = time.Parse("2006-01-02", os.Args[3])
+		targetDate, err = time.ParseInLocation("2006-01-02", os.Args[3], config.ConfigData.Campus.Location)
 		if err != nil {
 			fmt.Printf("Invalid date format: '%s'. Expected format: YYYY-MM-DD\n", os.Args[3])
 			os.Exit(1)
 		}
 	} else {
-		targetDate = time.Now()
+		targetDate = time.Now().In(config.ConfigData.Campus.Location)
 	}
-
-	// Init
-	config.LoadConfig(os.Args[1])
 	logFile := fmt.Sprintf("%swatchdog-%s.log", logPath, targetDate.Format("2006-01-02"))
 	err = watchdog.Init(logFile)
 	if err != nil {
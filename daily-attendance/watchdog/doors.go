@@ -0,0 +1,106 @@
+package watchdog
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+const (
+	DOOR_ENTRY    string = "entry"
+	DOOR_EXIT     string = "exit"
+	DOOR_INTERNAL string = "internal"
+)
+
+// One badge usage of a user during the day
+type Swipe struct {
+	Time      time.Time
+	Door      string
+	Direction string
+	Period    int // Index of the watch period of the day
+}
+
+// Time range a user spent on site
+type PresenceSegment struct {
+	Begin  time.Time
+	End    time.Time
+	Period int
+}
+
+func (segment PresenceSegment) Duration() time.Duration {
+	return segment.End.Sub(segment.Begin)
+}
+
+/*
+Tell if a door lets people in, out, or is inside the campus.
+Doors missing from config are internal, so a campus without door config keeps first -> last durations.
+*/
+func classifyDoor(doorName string, deviceName string) string {
+	doors := config.ConfigData.Doors
+	for _, name := range []string{doorName, deviceName} {
+		if name == "" {
+			continue
+		}
+		for _, entry := range doors.Entry {
+			if strings.EqualFold(entry, name) {
+				return DOOR_ENTRY
+			}
+		}
+		for _, exit := range doors.Exit {
+			if strings.EqualFold(exit, name) {
+				return DOOR_EXIT
+			}
+		}
+	}
+	return DOOR_INTERNAL
+}
+
+/*
+Record a badge usage and recompute the user's access times and on-site duration
+*/
+func addSwipe(user *User, swipe Swipe) {
+	user.Swipes = append(user.Swipes, swipe)
+	sort.SliceStable(user.Swipes, func(i, j int) bool {
+		return user.Swipes[i].Time.Before(user.Swipes[j].Time)
+	})
+
+	user.FirstAccess = user.Swipes[0].Time
+	user.LastAccess = user.Swipes[len(user.Swipes)-1].Time
+	user.Duration = 0
+	for _, segment := range presenceSegments(user.Swipes) {
+		user.Duration += segment.Duration()
+	}
+}
+
+/*
+Rebuild on-site ranges from ordered swipes.
+An entry opens a segment and an exit closes it. Any other swipe proves the user is on site,
+so it opens a segment if none is open. An exit without open segment can't be dated and is ignored.
+A segment never closed ends on the last swipe seen, or when its watch period ends.
+*/
+func presenceSegments(swipes []Swipe) []PresenceSegment {
+	var segments []PresenceSegment
+	var current *PresenceSegment
+	for _, swipe := range swipes {
+		if current != nil && current.Period != swipe.Period {
+			segments = append(segments, *current)
+			current = nil
+		}
+		if current == nil {
+			if swipe.Direction == DOOR_EXIT {
+				continue
+			}
+			current = &PresenceSegment{Begin: swipe.Time, Period: swipe.Period}
+		}
+		current.End = swipe.Time
+		if swipe.Direction == DOOR_EXIT {
+			segments = append(segments, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		segments = append(segments, *current)
+	}
+	return segments
+}
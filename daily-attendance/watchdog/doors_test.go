@@ -0,0 +1,66 @@
+package watchdog
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPresenceSegments(t *testing.T) {
+	day := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return day.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+	}
+	swipe := func(clock string, direction string, period int) Swipe {
+		return Swipe{Time: at(clock), Door: "door", Direction: direction, Period: period}
+	}
+	segment := func(begin, end string, period int) PresenceSegment {
+		return PresenceSegment{Begin: at(begin), End: at(end), Period: period}
+	}
+	tests := []struct {
+		name   string
+		swipes []Swipe
+		want   []PresenceSegment
+	}{
+		{name: "no swipe"},
+		{
+			name:   "entry and exit",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY, 0), swipe("12:00", DOOR_EXIT, 0)},
+			want:   []PresenceSegment{segment("08:00", "12:00", 0)},
+		},
+		{
+			name:   "exit without entry is ignored",
+			swipes: []Swipe{swipe("07:00", DOOR_EXIT, 0), swipe("08:00", DOOR_ENTRY, 0), swipe("12:00", DOOR_EXIT, 0)},
+			want:   []PresenceSegment{segment("08:00", "12:00", 0)},
+		},
+		{
+			name:   "internal swipe opens a segment",
+			swipes: []Swipe{swipe("09:00", DOOR_INTERNAL, 0), swipe("12:00", DOOR_EXIT, 0)},
+			want:   []PresenceSegment{segment("09:00", "12:00", 0)},
+		},
+		{
+			name:   "unclosed segment ends on the last swipe",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY, 0), swipe("12:00", DOOR_EXIT, 0), swipe("13:00", DOOR_ENTRY, 0), swipe("15:00", DOOR_INTERNAL, 0)},
+			want:   []PresenceSegment{segment("08:00", "12:00", 0), segment("13:00", "15:00", 0)},
+		},
+		{
+			name:   "a new watch period closes the open segment",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY, 0), swipe("11:00", DOOR_INTERNAL, 0), swipe("20:00", DOOR_INTERNAL, 1), swipe("23:00", DOOR_EXIT, 1)},
+			want:   []PresenceSegment{segment("08:00", "11:00", 0), segment("20:00", "23:00", 1)},
+		},
+		{
+			name:   "exit in a new watch period without entry is ignored",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY, 0), swipe("20:30", DOOR_EXIT, 1)},
+			want:   []PresenceSegment{segment("08:00", "08:00", 0)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := presenceSegments(test.swipes)
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("presenceSegments() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
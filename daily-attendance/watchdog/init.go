@@ -92,5 +92,10 @@ func Init(logPath string) error {
 		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
 		os.Exit(1)
 	}
+	err = InitWatchtime()
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
 	return nil
 }
@@ -0,0 +1,45 @@
+package watchdog
+
+import (
+	"time"
+	"watchdog/config"
+
+	"github.com/TheKrainBow/42-watchdog/ledger"
+	apiManager "github.com/TheKrainBow/go-api"
+)
+
+// Name written in the ledger, so we know which tool posted an attendance
+const ledgerPostedBy = "daily-attendance"
+
+var errAlreadyPosted = ledger.ErrAlreadyPosted
+
+// postingLedger returns the ledger shared with live-attendance, reporting times on campus time
+func postingLedger() *ledger.Ledger {
+	postLedger := &ledger.Ledger{
+		Path:      config.ConfigData.Ledger.Path,
+		PostedBy:  ledgerPostedBy,
+		Location:  config.ConfigData.Campus.Location,
+		Retention: time.Duration(config.ConfigData.Ledger.RetentionDays) * 24 * time.Hour,
+		Log:       Log,
+	}
+	if config.ConfigData.Ledger.CheckChronos {
+		postLedger.ChronosGet = apiManager.GetClient(config.FTAttendance).Get
+	}
+	return postLedger
+}
+
+// postAttendanceOnce posts an attendance unless an overlapping one was already posted,
+// by this script, by the live server, or directly on Chronos.
+func postAttendanceOnce(attendance APIAttendance) error {
+	begin, err := time.Parse(time.RFC3339, attendance.Begin_at)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.RFC3339, attendance.End_at)
+	if err != nil {
+		return err
+	}
+	return postingLedger().PostOnce(attendance.User_id, begin, end, func() error {
+		return postAttendance(attendance)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"time"
+	"watchdog/config"
 )
 
 var logFile *os.File
@@ -77,7 +78,7 @@ func Log(msg string) {
 		fmt.Fprintf(logFile, "\n")
 	} else {
 		msg = strings.TrimRight(msg, "\n")
-		fmt.Fprintf(logFile, "[%s] %s\n", time.Now().Format("06/01/02 - 15:04:05"), msg)
+		fmt.Fprintf(logFile, "[%s] %s\n", time.Now().In(config.ConfigData.Campus.Location).Format("06/01/02 - 15:04:05"), msg)
 	}
 }
 
@@ -89,8 +90,8 @@ func PrintUsersTimers() {
 	for _, value := range AllUsers {
 		Log(fmt.Sprintf(" %s: %s -> %s | Total : %dh%dm%ds\n",
 			value.Login42,
-			value.FirstAccess.Format("15:04:05"),
-			value.LastAccess.Format("15:04:05"),
+			value.FirstAccess.In(config.ConfigData.Campus.Location).Format("15:04:05"),
+			value.LastAccess.In(config.ConfigData.Campus.Location).Format("15:04:05"),
 			int(value.Duration.Hours()),
 			int(value.Duration.Minutes())%60,
 			int(value.Duration.Seconds())%60,
@@ -0,0 +1,74 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+/*
+Split a user's presence into the attendances to post, following 42Attendance.postStrategy
+*/
+func userAttendances(user User, id42 int) []APIAttendance {
+	segments := presenceSegments(user.Swipes)
+	var ranges []PresenceSegment
+	// Segments are the default: a span also credits the time spent outside between two badges
+	if config.ConfigData.Attendance42.PostStrategy == config.PostStrategySpan {
+		for _, segment := range segments {
+			if last := len(ranges) - 1; last >= 0 && ranges[last].Period == segment.Period {
+				ranges[last].End = segment.End
+			} else {
+				ranges = append(ranges, segment)
+			}
+		}
+	} else {
+		for _, segment := range segments {
+			if segment.Duration() > 0 {
+				ranges = append(ranges, segment)
+			}
+		}
+	}
+
+	attendances := make([]APIAttendance, 0, len(ranges))
+	for _, segment := range ranges {
+		attendances = append(attendances, APIAttendance{
+			Begin_at:  segment.Begin.UTC().Format(time.RFC3339),
+			End_at:    segment.End.UTC().Format(time.RFC3339),
+			Source:    config.ConfigData.Campus.AttendanceSource,
+			Campus_id: config.ConfigData.Campus.ID,
+			User_id:   id42,
+		})
+	}
+	return attendances
+}
+
+/*
+Post every attendance of a user. Returns errAlreadyPosted only if none was posted because of it
+*/
+func postUserAttendances(attendances []APIAttendance) error {
+	posted := 0
+	var alreadyPosted error
+	var failures []string
+	for _, attendance := range attendances {
+		err := postAttendanceOnce(attendance)
+		switch {
+		case errors.Is(err, errAlreadyPosted):
+			alreadyPosted = err
+		case err != nil:
+			failures = append(failures, err.Error())
+		default:
+			posted++
+		}
+	}
+	switch {
+	case len(failures) > 0 && len(attendances) > 1:
+		return fmt.Errorf("%d/%d attendances failed: %s", len(failures), len(attendances), strings.Join(failures, ", "))
+	case len(failures) > 0:
+		return errors.New(failures[0])
+	case posted == 0 && alreadyPosted != nil:
+		return alreadyPosted
+	}
+	return nil
+}
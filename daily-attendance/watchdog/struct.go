@@ -28,7 +28,8 @@ type User struct {
 	IsApprentice      bool
 	FirstAccess       time.Time
 	LastAccess        time.Time
-	Duration          time.Duration
+	Duration          time.Duration // Time spent on site, see presenceSegments
+	Swipes            []Swipe
 }
 
 type ProjectResponse struct {
@@ -2,6 +2,7 @@ package watchdog
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -65,8 +66,21 @@ func Watch(day time.Time) {
 Fetch events on access control, and parse the data to have a map of user
 */
 func GetDailyUsers(day time.Time) {
-	start := time.Date(day.Year(), day.Month(), day.Day(), 7, 30, 0, 0, time.UTC)
-	end := time.Date(day.Year(), day.Month(), day.Day(), 20, 30, 0, 0, time.UTC)
+	periods := dayPeriods(day)
+	if len(periods) == 0 {
+		Log(fmt.Sprintf("No watch period on %s\n", day.Format("Monday 2006-01-02")))
+		return
+	}
+	// Night periods end on the next day, their events are attributed to this day
+	start, end := periods[0].Begin, periods[0].End
+	for _, period := range periods[1:] {
+		if period.Begin.Before(start) {
+			start = period.Begin
+		}
+		if period.End.After(end) {
+			end = period.End
+		}
+	}
 	queryUrl := fmt.Sprintf("/events/?format=datatables&start_date=%s&end_date=%s&length=-1", formatTimeForURL(start), formatTimeForURL(end))
 	fmt.Printf("Fetching Control Access events\n")
 	Log(fmt.Sprintf("Fetching Control Access events for %s ...\n", day.Format("2006-01-02")))
@@ -97,31 +111,26 @@ func GetDailyUsers(day time.Time) {
 	for _, event := range res.Data {
 		if event.User != nil {
 			// Parse the datetime field
-			parsedTime, err := time.Parse(layout, event.DateTime)
+			parsedTime, err := time.ParseInLocation(layout, event.DateTime, config.ConfigData.Campus.Location)
 			if err != nil {
 				Log(fmt.Sprintf("ERROR: %s", err.Error()))
 				os.Exit(1)
 			}
 
+			period := periodOf(parsedTime, periods)
+			if period == -1 {
+				continue
+			}
+
 			// Print the parsed datetime and event details
 			user, exist := AllUsers[*event.User]
 			if !exist {
 				user = User{
 					ControlAccessID:   *event.User,
 					ControlAccessName: event.Data.UserName,
-					FirstAccess:       parsedTime,
-					LastAccess:        parsedTime,
-					Duration:          parsedTime.Sub(parsedTime),
 				}
 			}
-			if user.FirstAccess.IsZero() || user.FirstAccess.After(parsedTime) {
-				user.FirstAccess = parsedTime
-				user.Duration = user.LastAccess.Sub(user.FirstAccess)
-			}
-			if user.LastAccess.IsZero() || user.LastAccess.Before(parsedTime) {
-				user.LastAccess = parsedTime
-				user.Duration = user.LastAccess.Sub(user.FirstAccess)
-			}
+			addSwipe(&user, Swipe{Time: parsedTime, Door: event.Data.DoorName, Direction: classifyDoor(event.Data.DoorName, event.Data.DeviceName), Period: period})
 			AllUsers[*event.User] = user
 		}
 	}
@@ -334,6 +343,19 @@ func isProjectOngoing(login string, projectID string) bool {
 	return len(res) >= 1 && res[0].Status == "in_progress"
 }
 
+// postAttendance sends one attendance to Chronos
+func postAttendance(attendance APIAttendance) error {
+	resp, err := apiManager.GetClient(config.FTAttendance).Post("/attendances", attendance)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
 type APIAttendance struct {
 	Begin_at  string `json:"begin_at"`
 	End_at    string `json:"end_at"`
@@ -349,31 +371,25 @@ func PostApprenticesAttendances() {
 	postAttendanceActualSteps = 1
 	postAttendanceTotalSteps = total
 	for _, value := range AllUsers {
-		var resp *http.Response
 		box := getBoxChar(i, total)
 		id42, err := strconv.ParseInt(value.ID42, 10, 64)
 		if err != nil {
 			msg = fmt.Sprintf("couldn't convert string to int \"%s\"", value.ID42)
 		} else {
-			_ = id42
 			if config.ConfigData.Attendance42.AutoPost {
-				resp, err = apiManager.GetClient(config.FTAttendance).Post("/attendances", APIAttendance{
-					Begin_at:  value.FirstAccess.UTC().Format(time.RFC3339),
-					End_at:    value.LastAccess.UTC().Format(time.RFC3339),
-					Source:    "access-control",
-					Campus_id: 41,
-					User_id:   int(id42),
-				})
+				err = postUserAttendances(userAttendances(value, int(id42)))
 				if err != nil {
 					msg = err.Error()
 				} else {
-					msg = resp.Status
+					msg = "Posted"
 				}
 			} else {
 				msg = "AUTOPOST is OFF"
 			}
 		}
-		if err != nil || (config.ConfigData.Attendance42.AutoPost && resp.StatusCode != http.StatusOK) {
+		if errors.Is(err, errAlreadyPosted) {
+			Log(fmt.Sprintf("%s ⏭️  Skipped attendance for %s (%dh%dm%ds): %s\n", box, value.Login42, int(value.Duration.Hours()), int(value.Duration.Minutes())%60, int(value.Duration.Seconds())%60, msg))
+		} else if err != nil {
 			Log(fmt.Sprintf("%s ❌ Posted attendance for %s (%dh%dm%ds): %s\n", box, value.Login42, int(value.Duration.Hours()), int(value.Duration.Minutes())%60, int(value.Duration.Seconds())%60, msg))
 		} else {
 			Log(fmt.Sprintf("%s ✅ Posted attendance for %s (%dh%dm%ds): %s\n", box, value.Login42, int(value.Duration.Hours()), int(value.Duration.Minutes())%60, int(value.Duration.Seconds())%60, msg))
@@ -0,0 +1,135 @@
+package watchdog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"watchdog/config"
+)
+
+// Clock range events are counted in. A period ending before it starts ends the next day.
+type TimePeriod struct {
+	StartingTime time.Time
+	EndingTime   time.Time
+}
+
+var watchtime map[time.Weekday][]TimePeriod
+
+// Window used before watchtime was configurable
+var defaultWatchtime = [][]string{{"07:30:00", "20:30:00"}}
+
+func (period TimePeriod) crossesMidnight() bool {
+	return period.EndingTime.Before(period.StartingTime)
+}
+
+/*
+Return the start and end of the period starting on the given day, on campus time
+*/
+func (period TimePeriod) occurrence(day time.Time) PresenceSegment {
+	loc := config.ConfigData.Campus.Location
+	day = day.In(loc)
+	start := time.Date(day.Year(), day.Month(), day.Day(), period.StartingTime.Hour(), period.StartingTime.Minute(), period.StartingTime.Second(), 0, loc)
+	end := time.Date(day.Year(), day.Month(), day.Day(), period.EndingTime.Hour(), period.EndingTime.Minute(), period.EndingTime.Second(), 0, loc)
+	if period.crossesMidnight() {
+		end = end.AddDate(0, 0, 1)
+	}
+	return PresenceSegment{Begin: start, End: end}
+}
+
+/*
+Parse watch periods from config. Without any, every day uses the default window.
+*/
+func InitWatchtime() error {
+	days := map[time.Weekday][][]string{
+		time.Monday:    config.ConfigData.Watchtime.Monday,
+		time.Tuesday:   config.ConfigData.Watchtime.Tuesday,
+		time.Wednesday: config.ConfigData.Watchtime.Wednesday,
+		time.Thursday:  config.ConfigData.Watchtime.Thursday,
+		time.Friday:    config.ConfigData.Watchtime.Friday,
+		time.Saturday:  config.ConfigData.Watchtime.Saturday,
+		time.Sunday:    config.ConfigData.Watchtime.Sunday,
+	}
+	configured := false
+	for _, ranges := range days {
+		configured = configured || len(ranges) > 0
+	}
+
+	watchtime = make(map[time.Weekday][]TimePeriod)
+	for day, ranges := range days {
+		if !configured {
+			ranges = defaultWatchtime
+		}
+		for _, bounds := range ranges {
+			if len(bounds) != 2 {
+				return fmt.Errorf("invalid watchtime on %s: expected [start, end]", day)
+			}
+			first, err := time.Parse("15:04:05", bounds[0])
+			if err != nil {
+				return fmt.Errorf("couldn't parse watchtime `%s`", bounds[0])
+			}
+			last, err := time.Parse("15:04:05", bounds[1])
+			if err != nil {
+				return fmt.Errorf("couldn't parse watchtime `%s`", bounds[1])
+			}
+			if first.Equal(last) {
+				return fmt.Errorf("invalid watchtime on %s: %s -> %s", day, bounds[0], bounds[1])
+			}
+			watchtime[day] = append(watchtime[day], TimePeriod{StartingTime: first, EndingTime: last})
+		}
+		// Periods are listed in any order in the config, the first one starts earliest
+		sort.SliceStable(watchtime[day], func(i, j int) bool {
+			return watchtime[day][i].StartingTime.Before(watchtime[day][j].StartingTime)
+		})
+	}
+	return checkWatchtimeOverlaps()
+}
+
+/*
+Reject periods overlapping each other, night periods included: the last period of a day may end the next day,
+before the first period of that day.
+*/
+func checkWatchtimeOverlaps() error {
+	format := func(period TimePeriod) string {
+		return fmt.Sprintf("%s -> %s", period.StartingTime.Format("15:04:05"), period.EndingTime.Format("15:04:05"))
+	}
+	for day := range 7 {
+		periods := watchtime[time.Weekday(day)]
+		for i := 1; i < len(periods); i++ {
+			if periods[i-1].crossesMidnight() || periods[i-1].EndingTime.After(periods[i].StartingTime) {
+				return fmt.Errorf("invalid watchtime on %s: %s overlaps %s", time.Weekday(day), format(periods[i-1]), format(periods[i]))
+			}
+		}
+		if len(periods) == 0 || !periods[len(periods)-1].crossesMidnight() {
+			continue
+		}
+		night := periods[len(periods)-1]
+		next := watchtime[time.Weekday((day+1)%7)]
+		if len(next) > 0 && night.EndingTime.After(next[0].StartingTime) {
+			return fmt.Errorf("invalid watchtime on %s: %s overlaps %s of %s", time.Weekday(day), format(night), format(next[0]), time.Weekday((day+1)%7))
+		}
+	}
+	return nil
+}
+
+/*
+Return the watch periods starting on the given day, night ones ending on the next day
+*/
+func dayPeriods(day time.Time) []PresenceSegment {
+	var periods []PresenceSegment
+	for _, period := range watchtime[day.Weekday()] {
+		periods = append(periods, period.occurrence(day))
+	}
+	return periods
+}
+
+/*
+Return the index of the period containing timeStamp (start inclusive, end exclusive), -1 if none
+*/
+func periodOf(timeStamp time.Time, periods []PresenceSegment) int {
+	for i, period := range periods {
+		if !timeStamp.Before(period.Begin) && timeStamp.Before(period.End) {
+			return i
+		}
+	}
+	return -1
+}
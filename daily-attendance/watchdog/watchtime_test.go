@@ -0,0 +1,184 @@
+package watchdog
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"watchdog/config"
+)
+
+// useParis runs the test on Paris time and restores the config afterwards
+func useParis(t *testing.T) func(value string) time.Time {
+	t.Helper()
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no timezone database: %s", err)
+	}
+	saved := config.ConfigData
+	t.Cleanup(func() { config.ConfigData = saved })
+	config.ConfigData.Campus.Location = paris
+	return func(value string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", value, paris)
+		return parsed
+	}
+}
+
+// clearWatchtime removes the watch periods of every day from the config
+func clearWatchtime() {
+	watch := &config.ConfigData.Watchtime
+	watch.Monday, watch.Tuesday, watch.Wednesday, watch.Thursday, watch.Friday, watch.Saturday, watch.Sunday = nil, nil, nil, nil, nil, nil, nil
+}
+
+func clock(value string) time.Time {
+	parsed, _ := time.Parse("15:04:05", value)
+	return parsed
+}
+
+func TestOccurrence(t *testing.T) {
+	local := useParis(t)
+	tests := []struct {
+		name      string
+		start     string
+		end       string
+		day       time.Time
+		wantBegin string
+		wantEnd   string
+	}{
+		{name: "day period", start: "08:00:00", end: "18:00:00", day: local("2026-10-15 00:00"), wantBegin: "2026-10-15 08:00", wantEnd: "2026-10-15 18:00"},
+		{name: "night period ends the next day", start: "20:00:00", end: "02:00:00", day: local("2026-10-15 00:00"), wantBegin: "2026-10-15 20:00", wantEnd: "2026-10-16 02:00"},
+		{name: "night period over the end of the month", start: "22:00:00", end: "01:00:00", day: local("2026-10-31 00:00"), wantBegin: "2026-10-31 22:00", wantEnd: "2026-11-01 01:00"},
+		{name: "night period over a DST change", start: "20:00:00", end: "02:00:00", day: local("2026-10-24 00:00"), wantBegin: "2026-10-24 20:00", wantEnd: "2026-10-25 02:00"},
+		// 23:30 UTC is already the next day in Paris
+		{name: "day read on campus time", start: "08:00:00", end: "18:00:00", day: time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC), wantBegin: "2026-10-16 08:00", wantEnd: "2026-10-16 18:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := TimePeriod{StartingTime: clock(test.start), EndingTime: clock(test.end)}.occurrence(test.day)
+			if !got.Begin.Equal(local(test.wantBegin)) || !got.End.Equal(local(test.wantEnd)) {
+				t.Fatalf("occurrence() = %s -> %s, want %s -> %s", got.Begin, got.End, test.wantBegin, test.wantEnd)
+			}
+		})
+	}
+}
+
+func TestPeriodOf(t *testing.T) {
+	local := useParis(t)
+	day := local("2026-10-15 00:00")
+	periods := []PresenceSegment{
+		TimePeriod{StartingTime: clock("08:00:00"), EndingTime: clock("12:00:00")}.occurrence(day),
+		TimePeriod{StartingTime: clock("20:00:00"), EndingTime: clock("02:00:00")}.occurrence(day),
+	}
+	tests := []struct {
+		timeStamp string
+		want      int
+	}{
+		{timeStamp: "2026-10-15 07:59", want: -1},
+		{timeStamp: "2026-10-15 08:00", want: 0},
+		{timeStamp: "2026-10-15 11:59", want: 0},
+		{timeStamp: "2026-10-15 12:00", want: -1},
+		{timeStamp: "2026-10-15 20:00", want: 1},
+		{timeStamp: "2026-10-15 23:59", want: 1},
+		{timeStamp: "2026-10-16 00:00", want: 1},
+		{timeStamp: "2026-10-16 01:59", want: 1},
+		{timeStamp: "2026-10-16 02:00", want: -1},
+		{timeStamp: "2026-10-16 08:00", want: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.timeStamp, func(t *testing.T) {
+			if got := periodOf(local(test.timeStamp), periods); got != test.want {
+				t.Fatalf("periodOf() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInitWatchtime(t *testing.T) {
+	tests := []struct {
+		name     string
+		thursday [][]string
+		friday   [][]string
+		want     [][]string // Thursday periods once parsed
+		wantErr  string
+	}{
+		{
+			name:     "periods sorted by start",
+			thursday: [][]string{{"20:00:00", "02:00:00"}, {"08:00:00", "12:00:00"}},
+			want:     [][]string{{"08:00:00", "12:00:00"}, {"20:00:00", "02:00:00"}},
+		},
+		{
+			name:     "night period ending when the next day starts",
+			thursday: [][]string{{"20:00:00", "08:00:00"}},
+			friday:   [][]string{{"08:00:00", "12:00:00"}},
+			want:     [][]string{{"20:00:00", "08:00:00"}},
+		},
+		{
+			name:     "overlapping periods",
+			thursday: [][]string{{"13:00:00", "18:00:00"}, {"08:00:00", "14:00:00"}},
+			wantErr:  "08:00:00 -> 14:00:00 overlaps 13:00:00 -> 18:00:00",
+		},
+		{
+			name:     "night period before another one",
+			thursday: [][]string{{"20:00:00", "02:00:00"}, {"22:00:00", "23:00:00"}},
+			wantErr:  "20:00:00 -> 02:00:00 overlaps 22:00:00 -> 23:00:00",
+		},
+		{
+			name:     "night period overlapping the next day",
+			thursday: [][]string{{"20:00:00", "09:00:00"}},
+			friday:   [][]string{{"08:00:00", "12:00:00"}},
+			wantErr:  "overlaps 08:00:00 -> 12:00:00 of Friday",
+		},
+		{
+			name:     "start equal to end",
+			thursday: [][]string{{"08:00:00", "08:00:00"}},
+			wantErr:  "invalid watchtime on Thursday",
+		},
+		{
+			name:     "unparsable time",
+			thursday: [][]string{{"08:00", "12:00:00"}},
+			wantErr:  "couldn't parse watchtime `08:00`",
+		},
+	}
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearWatchtime()
+			config.ConfigData.Watchtime.Thursday = test.thursday
+			config.ConfigData.Watchtime.Friday = test.friday
+			err := InitWatchtime()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("InitWatchtime() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InitWatchtime() error = %v", err)
+			}
+			got := watchtime[time.Thursday]
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d periods on Thursday, want %d", len(got), len(test.want))
+			}
+			for i, bounds := range test.want {
+				if !got[i].StartingTime.Equal(clock(bounds[0])) || !got[i].EndingTime.Equal(clock(bounds[1])) {
+					t.Fatalf("period %d is %s -> %s, want %s -> %s", i, got[i].StartingTime.Format("15:04:05"), got[i].EndingTime.Format("15:04:05"), bounds[0], bounds[1])
+				}
+			}
+		})
+	}
+}
+
+func TestInitWatchtimeDefault(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	clearWatchtime()
+	if err := InitWatchtime(); err != nil {
+		t.Fatalf("InitWatchtime() error = %v", err)
+	}
+	for day := range 7 {
+		periods := watchtime[time.Weekday(day)]
+		if len(periods) != 1 || !periods[0].StartingTime.Equal(clock(defaultWatchtime[0][0])) || !periods[0].EndingTime.Equal(clock(defaultWatchtime[0][1])) {
+			t.Fatalf("%s periods = %v, want the default window", time.Weekday(day), periods)
+		}
+	}
+}
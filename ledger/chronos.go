@@ -0,0 +1,50 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type chronosAttendance struct {
+	BeginAt string `json:"begin_at"`
+	EndAt   string `json:"end_at"`
+}
+
+// ChronosHasOverlap asks Chronos if the user already has an attendance overlapping [begin, end].
+// get sends a GET request to the Chronos API, with the client of the calling tool.
+func ChronosHasOverlap(get func(path string) (*http.Response, error), userID int, begin, end time.Time) (bool, error) {
+	query := fmt.Sprintf("/users/%d/attendances?begin_at=%s&end_at=%s",
+		userID,
+		url.QueryEscape(begin.Add(-24*time.Hour).UTC().Format(time.RFC3339)),
+		url.QueryEscape(end.Add(24*time.Hour).UTC().Format(time.RFC3339)),
+	)
+	resp, err := get(query)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s", resp.Status)
+	}
+	var existing []chronosAttendance
+	if err = json.NewDecoder(resp.Body).Decode(&existing); err != nil {
+		return false, err
+	}
+	for _, attendance := range existing {
+		existingBegin, err := time.Parse(time.RFC3339, attendance.BeginAt)
+		if err != nil {
+			continue
+		}
+		existingEnd, err := time.Parse(time.RFC3339, attendance.EndAt)
+		if err != nil {
+			continue
+		}
+		if overlaps(begin, end, existingBegin, existingEnd) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
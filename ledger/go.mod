@@ -0,0 +1,3 @@
+module github.com/TheKrainBow/42-watchdog/ledger
+
+go 1.24.4
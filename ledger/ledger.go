@@ -0,0 +1,302 @@
+// Package ledger keeps the record of the attendances posted to Chronos, shared by live-attendance and daily-attendance,
+// so an attendance is never posted twice, whichever tool posts it.
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	STATE_POSTED   string = ""         // Attendance posted to Chronos
+	STATE_PENDING  string = "pending"  // Attendance being posted, other posts of the same range wait for it
+	STATE_RELEASED string = "released" // Post given up, the range is free again
+)
+
+// A pending entry older than this belongs to a tool that stopped while posting, it doesn't block anymore
+const reservationTimeout = 10 * time.Minute
+
+// The file is rewritten with its live entries once it holds at least this many lines, half of them dead
+const compactMinLines = 1000
+
+// One line of the ledger file
+type Entry struct {
+	UserID   int       `json:"user_id"`
+	BeginAt  time.Time `json:"begin_at"`
+	EndAt    time.Time `json:"end_at"`
+	PostedAt time.Time `json:"posted_at"`
+	PostedBy string    `json:"posted_by"`
+	State    string    `json:"state,omitempty"`
+}
+
+var ErrAlreadyPosted = errors.New("overlaps an attendance already posted")
+
+// The other tool is posting an overlapping attendance, try again later
+var ErrBeingPosted = errors.New("overlaps an attendance being posted")
+
+// Ledger file as seen by one tool. An empty Path disables the ledger: attendances are posted without any check.
+type Ledger struct {
+	Path      string
+	PostedBy  string         // Written in the entries of this tool
+	Location  *time.Location // Timezone of the campus, used to report when an attendance was posted
+	Retention time.Duration  // Posted entries ending earlier than this are dropped when the file is compacted, 0 keeps them
+	// Sends a GET request to the Chronos API. When set, Chronos is checked for existing attendances before posting.
+	ChronosGet func(path string) (*http.Response, error)
+	Log        func(msg string) // Errors that don't prevent the post, may be nil
+}
+
+// Reservation of a range, held while the attendance is posted. It must end with Posted, FoundOnChronos or Release.
+type Reservation struct {
+	ledger *Ledger
+	entry  Entry
+}
+
+func (ledger *Ledger) location() *time.Location {
+	if ledger.Location == nil {
+		return time.Local
+	}
+	return ledger.Location
+}
+
+func (ledger *Ledger) log(msg string) {
+	if ledger.Log != nil {
+		ledger.Log(msg)
+	}
+}
+
+func overlaps(beginA, endA, beginB, endB time.Time) bool {
+	return beginA.Before(endB) && beginB.Before(endA)
+}
+
+func (entry Entry) sameRange(other Entry) bool {
+	return entry.UserID == other.UserID && entry.BeginAt.Equal(other.BeginAt) && entry.EndAt.Equal(other.EndAt) && entry.PostedBy == other.PostedBy
+}
+
+// withLock runs fn on the ledger file, locked against the other tool
+func (ledger *Ledger) withLock(fn func(file *os.File) error) error {
+	for {
+		file, err := os.OpenFile(ledger.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("couldn't open ledger: %w", err)
+		}
+		if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+			file.Close()
+			return fmt.Errorf("couldn't lock ledger: %w", err)
+		}
+		// Compaction replaces the file: if it happened while waiting for the lock, open the new one
+		opened, openedErr := file.Stat()
+		current, currentErr := os.Stat(ledger.Path)
+		if openedErr == nil && currentErr == nil && os.SameFile(opened, current) {
+			err = fn(file)
+			syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+			file.Close()
+			return err
+		}
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+}
+
+// readActive returns the posted entries and the pending ones not resolved yet, and the number of lines read
+func readActive(file *os.File) ([]Entry, int, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var active []Entry
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		// A posted or released entry ends the reservation of the same range
+		if entry.State != STATE_PENDING {
+			for i := 0; i < len(active); i++ {
+				if active[i].State == STATE_PENDING && active[i].sameRange(entry) {
+					active = append(active[:i], active[i+1:]...)
+					i--
+				}
+			}
+		}
+		if entry.State != STATE_RELEASED {
+			active = append(active, entry)
+		}
+	}
+	return active, lines, scanner.Err()
+}
+
+func appendEntry(file *os.File, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (ledger *Ledger) append(entry Entry) error {
+	return ledger.withLock(func(file *os.File) error {
+		return appendEntry(file, entry)
+	})
+}
+
+// expired tells if an entry can be dropped from the file
+func (ledger *Ledger) expired(entry Entry, now time.Time) bool {
+	if entry.State == STATE_PENDING {
+		return now.Sub(entry.PostedAt) > reservationTimeout
+	}
+	return ledger.Retention > 0 && now.Sub(entry.EndAt) > ledger.Retention
+}
+
+// compact rewrites the file with the given entries, minus the expired ones. The ledger must be locked.
+// The new file replaces the old one atomically, so a crash never leaves a truncated ledger.
+func (ledger *Ledger) compact(entries []Entry, now time.Time) error {
+	tmpPath := ledger.Path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		if ledger.expired(entry, now) {
+			continue
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err = writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, ledger.Path)
+}
+
+// Reserve checks no attendance overlapping [begin, end] was posted or is being posted for the user, and reserves the range.
+// The ledger is only locked while reading and writing, not while the attendance is posted.
+func (ledger *Ledger) Reserve(userID int, begin, end time.Time) (*Reservation, error) {
+	reservation := &Reservation{ledger: ledger, entry: Entry{UserID: userID, BeginAt: begin, EndAt: end, PostedBy: ledger.PostedBy, State: STATE_PENDING}}
+	err := ledger.withLock(func(file *os.File) error {
+		entries, lines, err := readActive(file)
+		if err != nil {
+			return fmt.Errorf("couldn't read ledger: %w", err)
+		}
+		now := time.Now()
+		live := 0
+		for _, entry := range entries {
+			if ledger.expired(entry, now) {
+				continue
+			}
+			live++
+			if entry.UserID != userID || !overlaps(begin, end, entry.BeginAt, entry.EndAt) {
+				continue
+			}
+			if entry.State == STATE_PENDING {
+				return fmt.Errorf("%w by %s since %s", ErrBeingPosted, entry.PostedBy, entry.PostedAt.In(ledger.location()).Format("02/01/2006 15:04:05"))
+			}
+			return fmt.Errorf("%w by %s at %s", ErrAlreadyPosted, entry.PostedBy, entry.PostedAt.In(ledger.location()).Format("02/01/2006 15:04:05"))
+		}
+		reservation.entry.PostedAt = now
+		if err = appendEntry(file, reservation.entry); err != nil {
+			return err
+		}
+		if lines+1 >= compactMinLines && 2*(live+1) <= lines+1 {
+			if err = ledger.compact(append(entries, reservation.entry), now); err != nil {
+				ledger.log(fmt.Sprintf("ERROR: couldn't compact ledger: %s", err.Error()))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// Posted records the attendance as posted
+func (reservation *Reservation) Posted() error {
+	entry := reservation.entry
+	entry.PostedAt = time.Now()
+	entry.State = STATE_POSTED
+	return reservation.ledger.append(entry)
+}
+
+// FoundOnChronos records an attendance found on Chronos over the reserved range, and releases the reservation
+func (reservation *Reservation) FoundOnChronos() error {
+	return reservation.ledger.withLock(func(file *os.File) error {
+		found := reservation.entry
+		found.PostedAt = time.Now()
+		found.PostedBy = "chronos"
+		found.State = STATE_POSTED
+		if err := appendEntry(file, found); err != nil {
+			return err
+		}
+		released := reservation.entry
+		released.PostedAt = found.PostedAt
+		released.State = STATE_RELEASED
+		return appendEntry(file, released)
+	})
+}
+
+// Release frees the reserved range, when the post failed
+func (reservation *Reservation) Release() error {
+	entry := reservation.entry
+	entry.PostedAt = time.Now()
+	entry.State = STATE_RELEASED
+	return reservation.ledger.append(entry)
+}
+
+// PostOnce posts an attendance of the user over [begin, end] with post, unless an overlapping one was already posted,
+// by either tool or directly on Chronos. The range is reserved while posting, so both tools can't post it concurrently.
+func (ledger *Ledger) PostOnce(userID int, begin, end time.Time, post func() error) error {
+	if ledger.Path == "" {
+		return post()
+	}
+	reservation, err := ledger.Reserve(userID, begin, end)
+	if err != nil {
+		return err
+	}
+
+	if ledger.ChronosGet != nil {
+		found, err := ChronosHasOverlap(ledger.ChronosGet, userID, begin, end)
+		if err != nil {
+			ledger.log(fmt.Sprintf("⚠️  Couldn't check existing Chronos attendances of %d: %s", userID, err.Error()))
+		} else if found {
+			if err = reservation.FoundOnChronos(); err != nil {
+				ledger.log(fmt.Sprintf("ERROR: couldn't write Chronos attendance of %d to ledger: %s", userID, err.Error()))
+			}
+			return fmt.Errorf("%w on Chronos", ErrAlreadyPosted)
+		}
+	}
+
+	if err = post(); err != nil {
+		if releaseErr := reservation.Release(); releaseErr != nil {
+			ledger.log(fmt.Sprintf("ERROR: couldn't release ledger reservation of %d: %s", userID, releaseErr.Error()))
+		}
+		return err
+	}
+	if err = reservation.Posted(); err != nil {
+		ledger.log(fmt.Sprintf("ERROR: attendance of %d posted but not written to ledger: %s", userID, err.Error()))
+	}
+	return nil
+}
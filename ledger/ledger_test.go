@@ -0,0 +1,291 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+
+func at(clock string) time.Time {
+	parsed, _ := time.Parse("15:04", clock)
+	return day.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+}
+
+func writeEntries(t *testing.T, path string, entries ...Entry) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, entry := range entries {
+		if err := appendEntry(file, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestReserve(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		existing []Entry
+		userID   int
+		begin    string
+		end      string
+		wantErr  error
+	}{
+		{name: "empty ledger", userID: 1, begin: "08:00", end: "12:00"},
+		{
+			name:     "overlaps a posted attendance",
+			existing: []Entry{{UserID: 1, BeginAt: at("09:00"), EndAt: at("10:00"), PostedAt: now, PostedBy: "daily-attendance"}},
+			userID:   1, begin: "08:00", end: "12:00",
+			wantErr: ErrAlreadyPosted,
+		},
+		{
+			name:     "attendance of another user",
+			existing: []Entry{{UserID: 2, BeginAt: at("09:00"), EndAt: at("10:00"), PostedAt: now, PostedBy: "daily-attendance"}},
+			userID:   1, begin: "08:00", end: "12:00",
+		},
+		{
+			name:     "adjacent ranges don't overlap",
+			existing: []Entry{{UserID: 1, BeginAt: at("12:00"), EndAt: at("14:00"), PostedAt: now, PostedBy: "daily-attendance"}},
+			userID:   1, begin: "08:00", end: "12:00",
+		},
+		{
+			name:     "overlaps an attendance being posted",
+			existing: []Entry{{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now.Add(-time.Minute), PostedBy: "daily-attendance", State: STATE_PENDING}},
+			userID:   1, begin: "08:00", end: "12:00",
+			wantErr: ErrBeingPosted,
+		},
+		{
+			name:     "stale reservation is ignored",
+			existing: []Entry{{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now.Add(-reservationTimeout - time.Minute), PostedBy: "daily-attendance", State: STATE_PENDING}},
+			userID:   1, begin: "08:00", end: "12:00",
+		},
+		{
+			name: "released reservation is ignored",
+			existing: []Entry{
+				{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now, PostedBy: "daily-attendance", State: STATE_PENDING},
+				{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now, PostedBy: "daily-attendance", State: STATE_RELEASED},
+			},
+			userID: 1, begin: "08:00", end: "12:00",
+		},
+		{
+			name: "posted reservation blocks",
+			existing: []Entry{
+				{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now.Add(-time.Hour), PostedBy: "daily-attendance", State: STATE_PENDING},
+				{UserID: 1, BeginAt: at("11:00"), EndAt: at("13:00"), PostedAt: now.Add(-time.Hour), PostedBy: "daily-attendance"},
+			},
+			userID: 1, begin: "08:00", end: "12:00",
+			wantErr: ErrAlreadyPosted,
+		},
+		{
+			name:     "ledger written before reservations existed",
+			existing: []Entry{{UserID: 1, BeginAt: at("08:00"), EndAt: at("12:00"), PostedAt: now, PostedBy: "live-attendance"}},
+			userID:   1, begin: "08:00", end: "12:00",
+			wantErr: ErrAlreadyPosted,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "posted.jsonl")
+			writeEntries(t, path, test.existing...)
+			ledger := &Ledger{Path: path, PostedBy: "live-attendance"}
+			reservation, err := ledger.Reserve(test.userID, at(test.begin), at(test.end))
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Reserve() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			entries := readEntries(t, path)
+			last := entries[len(entries)-1]
+			if last.State != STATE_PENDING || !last.sameRange(reservation.entry) {
+				t.Fatalf("last entry = %+v, want the reservation", last)
+			}
+		})
+	}
+}
+
+func TestReservationBlocksOtherTool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posted.jsonl")
+	live := &Ledger{Path: path, PostedBy: "live-attendance"}
+	daily := &Ledger{Path: path, PostedBy: "daily-attendance"}
+
+	reservation, err := live.Reserve(1, at("08:00"), at("12:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = daily.Reserve(1, at("10:00"), at("11:00")); !errors.Is(err, ErrBeingPosted) {
+		t.Fatalf("Reserve() while posting error = %v, want %v", err, ErrBeingPosted)
+	}
+	if err = reservation.Release(); err != nil {
+		t.Fatal(err)
+	}
+	retry, err := daily.Reserve(1, at("10:00"), at("11:00"))
+	if err != nil {
+		t.Fatalf("Reserve() after release error = %v", err)
+	}
+	if err = retry.Posted(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = live.Reserve(1, at("08:00"), at("12:00")); !errors.Is(err, ErrAlreadyPosted) {
+		t.Fatalf("Reserve() after post error = %v, want %v", err, ErrAlreadyPosted)
+	}
+}
+
+func chronosAnswer(body string) func(string) (*http.Response, error) {
+	return func(string) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
+}
+
+func TestPostOnce(t *testing.T) {
+	errPost := errors.New("chronos is down")
+	tests := []struct {
+		name       string
+		chronos    func(string) (*http.Response, error)
+		postErr    error
+		wantErr    error
+		wantPosted bool
+		wantFree   bool // The range can be reserved again
+	}{
+		{name: "posted", wantPosted: true},
+		{name: "failed post releases the range", postErr: errPost, wantErr: errPost, wantFree: true},
+		{
+			name:    "already on Chronos",
+			chronos: chronosAnswer(`[{"begin_at":"2026-10-15T09:00:00Z","end_at":"2026-10-15T10:00:00Z"}]`),
+			wantErr: ErrAlreadyPosted,
+		},
+		{
+			name:       "nothing on Chronos",
+			chronos:    chronosAnswer(`[{"begin_at":"2026-10-15T13:00:00Z","end_at":"2026-10-15T14:00:00Z"}]`),
+			wantPosted: true,
+		},
+		{
+			name:       "Chronos unreachable still posts",
+			chronos:    func(string) (*http.Response, error) { return nil, errors.New("timeout") },
+			wantPosted: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "posted.jsonl")
+			ledger := &Ledger{Path: path, PostedBy: "live-attendance", ChronosGet: test.chronos}
+			posted := false
+			err := ledger.PostOnce(1, at("08:00"), at("12:00"), func() error {
+				posted = test.postErr == nil
+				return test.postErr
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("PostOnce() error = %v, want %v", err, test.wantErr)
+			}
+			if posted != test.wantPosted {
+				t.Fatalf("posted = %t, want %t", posted, test.wantPosted)
+			}
+			_, err = ledger.Reserve(1, at("08:00"), at("12:00"))
+			if free := err == nil; free != test.wantFree {
+				t.Fatalf("range free after PostOnce = %t (%v), want %t", free, err, test.wantFree)
+			}
+		})
+	}
+}
+
+func TestPostOnceWithoutLedger(t *testing.T) {
+	calls := 0
+	ledger := &Ledger{}
+	for range 2 {
+		if err := ledger.PostOnce(1, at("08:00"), at("12:00"), func() error { calls++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("post called %d times, want 2", calls)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posted.jsonl")
+	now := time.Now()
+	var existing []Entry
+	// Released reservations and attendances past retention are dead lines
+	for i := range compactMinLines / 2 {
+		begin := day.Add(time.Duration(i) * time.Hour)
+		existing = append(existing,
+			Entry{UserID: 1, BeginAt: begin, EndAt: begin.Add(time.Hour), PostedAt: now, PostedBy: "live-attendance", State: STATE_PENDING},
+			Entry{UserID: 1, BeginAt: begin, EndAt: begin.Add(time.Hour), PostedAt: now, PostedBy: "live-attendance", State: STATE_RELEASED},
+		)
+	}
+	old := Entry{UserID: 2, BeginAt: now.AddDate(0, 0, -400), EndAt: now.AddDate(0, 0, -400).Add(time.Hour), PostedAt: now, PostedBy: "daily-attendance"}
+	kept := Entry{UserID: 3, BeginAt: now.AddDate(0, 0, -10), EndAt: now.AddDate(0, 0, -10).Add(time.Hour), PostedAt: now, PostedBy: "daily-attendance"}
+	existing = append(existing, old, kept)
+	writeEntries(t, path, existing...)
+
+	ledger := &Ledger{Path: path, PostedBy: "live-attendance", Retention: 365 * 24 * time.Hour}
+	reservation, err := ledger.Reserve(4, at("08:00"), at("12:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("compacted ledger holds %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].UserID != kept.UserID || !entries[1].sameRange(reservation.entry) {
+		t.Fatalf("compacted ledger = %+v", entries)
+	}
+	// The reservation is still honoured after compaction, and the new file is written to
+	if _, err = ledger.Reserve(4, at("09:00"), at("10:00")); !errors.Is(err, ErrBeingPosted) {
+		t.Fatalf("Reserve() after compaction error = %v, want %v", err, ErrBeingPosted)
+	}
+	if err = reservation.Posted(); err != nil {
+		t.Fatal(err)
+	}
+	if entries = readEntries(t, path); len(entries) != 3 {
+		t.Fatalf("ledger holds %d entries after post, want 3", len(entries))
+	}
+}
+
+func TestNoCompactionBelowThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posted.jsonl")
+	now := time.Now()
+	writeEntries(t, path,
+		Entry{UserID: 1, BeginAt: at("08:00"), EndAt: at("09:00"), PostedAt: now, PostedBy: "live-attendance", State: STATE_PENDING},
+		Entry{UserID: 1, BeginAt: at("08:00"), EndAt: at("09:00"), PostedAt: now, PostedBy: "live-attendance", State: STATE_RELEASED},
+	)
+	ledger := &Ledger{Path: path, PostedBy: "live-attendance"}
+	if _, err := ledger.Reserve(1, at("10:00"), at("11:00")); err != nil {
+		t.Fatal(err)
+	}
+	if entries := readEntries(t, path); len(entries) != 3 {
+		t.Fatalf("ledger holds %d entries, want 3", len(entries))
+	}
+}
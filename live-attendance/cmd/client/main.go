@@ -7,18 +7,73 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
+const tokenEnv = "WATCHDOG_TOKEN"
+const defaultServerURL = "http://localhost:8042/commands"
+
+// Client settings file, so the token doesn't have to be typed in each command
+type ClientConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
 type CommandRequest struct {
 	Command    string         `json:"command"`
 	Parameters map[string]any `json:"parameters,omitempty"`
 }
 
 var serverURL string
+var campusName string
+var clientConfigPath string
+var outputFormat string
+var token string
+
+func defaultClientConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "watchdog", "client.yml")
+}
+
+// loadClientConfig reads the token and URL from the config file, the WATCHDOG_TOKEN variable taking precedence.
+// The default config file is optional, one given with --config must exist.
+func loadClientConfig(cmd *cobra.Command) error {
+	var clientConfig ClientConfig
+	if clientConfigPath != "" {
+		data, err := os.ReadFile(clientConfigPath)
+		if err != nil && (cmd.Flags().Changed("config") || !os.IsNotExist(err)) {
+			return fmt.Errorf("couldn't read client config: %w", err)
+		}
+		if err == nil {
+			if err = yaml.Unmarshal(data, &clientConfig); err != nil {
+				return fmt.Errorf("couldn't parse client config %s: %w", clientConfigPath, err)
+			}
+		}
+	}
+	if !cmd.Flags().Changed("url") && clientConfig.URL != "" {
+		serverURL = clientConfig.URL
+	}
+	token = clientConfig.Token
+	if value := os.Getenv(tokenEnv); value != "" {
+		token = value
+	}
+	return nil
+}
 
 func sendCommand(command string, params map[string]any) {
+	if campusName != "" {
+		if params == nil {
+			params = map[string]any{}
+		}
+		params["campus"] = campusName
+	}
 	cmdReq := CommandRequest{
 		Command:    command,
 		Parameters: params,
@@ -30,31 +85,50 @@ func sendCommand(command string, params map[string]any) {
 		os.Exit(1)
 	}
 
-	resp, err := http.Post(serverURL, "application/json", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequest(http.MethodPost, serverURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		fmt.Println("Request error:", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		fmt.Println("Request error:", err)
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("Status: %s\n", resp.Status)
-
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return
+		fmt.Println("Response error:", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	fmt.Printf("Response: %s\n", bodyBytes)
+	if err = printResponse(outputFormat, bodyBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error (%s): %s\n", resp.Status, err.Error())
+		os.Exit(1)
+	}
 }
 
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "watchdog-client",
 		Short: "Client for sending commands to the watchdog server",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutputFormat(outputFormat); err != nil {
+				return err
+			}
+			return loadClientConfig(cmd)
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&serverURL, "url", "u", "http://localhost:8042/commands", "Full URL of the server endpoint")
+	rootCmd.PersistentFlags().StringVarP(&serverURL, "url", "u", defaultServerURL, "Full URL of the server endpoint")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format: table, json or csv")
+	rootCmd.PersistentFlags().StringVar(&clientConfigPath, "config", defaultClientConfigPath(), "Client config file holding the url and token (token can also be set with "+tokenEnv+")")
+	rootCmd.PersistentFlags().StringVar(&campusName, "campus", "", "Campus the command applies to, when the server serves several (default: every campus)")
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "start",
@@ -87,6 +161,198 @@ func main() {
 		},
 	})
 
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Send get_history command",
+		Run: func(cmd *cobra.Command, args []string) {
+			params := map[string]any{}
+			for _, name := range []string{"login", "from", "to"} {
+				if value, _ := cmd.Flags().GetString(name); value != "" {
+					params[name] = value
+				}
+			}
+			sendCommand("get_history", params)
+		},
+	}
+	historyCmd.Flags().String("login", "", "Only show records of this student")
+	historyCmd.Flags().String("from", "", "First day to show (YYYY-MM-DD)")
+	historyCmd.Flags().String("to", "", "Last day to show (YYYY-MM-DD)")
+	rootCmd.AddCommand(historyCmd)
+
+	outboxCmd := &cobra.Command{
+		Use:   "outbox",
+		Short: "Manage attendances waiting to be posted again",
+	}
+	outboxCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Send outbox_list command",
+		Run: func(cmd *cobra.Command, args []string) {
+			sendCommand("outbox_list", nil)
+		},
+	})
+	outboxRetryCmd := &cobra.Command{
+		Use:   "retry",
+		Short: "Send outbox_retry command",
+		Run: func(cmd *cobra.Command, args []string) {
+			params := map[string]any{}
+			if cmd.Flags().Changed("id") {
+				id, _ := cmd.Flags().GetUint64("id")
+				params["id"] = id
+			}
+			sendCommand("outbox_retry", params)
+		},
+	}
+	outboxRetryCmd.Flags().Uint64("id", 0, "Only retry this entry (default: every entry)")
+	outboxCmd.AddCommand(outboxRetryCmd)
+	outboxDropCmd := &cobra.Command{
+		Use:   "drop",
+		Short: "Send outbox_drop command",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetUint64("id")
+			sendCommand("outbox_drop", map[string]any{"id": id})
+		},
+	}
+	outboxDropCmd.Flags().Uint64("id", 0, "Entry to drop without posting")
+	outboxDropCmd.MarkFlagRequired("id")
+	outboxCmd.AddCommand(outboxDropCmd)
+	rootCmd.AddCommand(outboxCmd)
+
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Show or edit jobs run by the server",
+	}
+	scheduleCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Send get_schedule command",
+		Run: func(cmd *cobra.Command, args []string) {
+			sendCommand("get_schedule", nil)
+		},
+	})
+	scheduleAddCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Send add_job command",
+		Run: func(cmd *cobra.Command, args []string) {
+			at, _ := cmd.Flags().GetString("time")
+			action, _ := cmd.Flags().GetString("action")
+			days, _ := cmd.Flags().GetStringSlice("days")
+			sendCommand("add_job", map[string]any{
+				"time":   at,
+				"action": action,
+				"days":   days,
+			})
+		},
+	}
+	scheduleAddCmd.Flags().String("time", "", "Time of the job (HH:MM)")
+	scheduleAddCmd.Flags().String("action", "", "start_listen, stop_listen, post_attendances, notify_students, daily_report or delete_all_pisciner")
+	scheduleAddCmd.Flags().StringSlice("days", nil, "Days the job runs on (default: every day)")
+	scheduleAddCmd.MarkFlagRequired("time")
+	scheduleAddCmd.MarkFlagRequired("action")
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleRemoveCmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Send remove_job command",
+		Run: func(cmd *cobra.Command, args []string) {
+			id, _ := cmd.Flags().GetInt("id")
+			sendCommand("remove_job", map[string]any{"id": id})
+		},
+	}
+	scheduleRemoveCmd.Flags().Int("id", 0, "Job to remove")
+	scheduleRemoveCmd.MarkFlagRequired("id")
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	rootCmd.AddCommand(scheduleCmd)
+
+	calendarCmd := &cobra.Command{
+		Use:   "calendar",
+		Short: "Show or edit campus closure days",
+	}
+	calendarCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Send get_calendar command",
+		Run: func(cmd *cobra.Command, args []string) {
+			sendCommand("get_calendar", nil)
+		},
+	})
+	calendarAddCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Send add_closure command",
+		Run: func(cmd *cobra.Command, args []string) {
+			date, _ := cmd.Flags().GetString("date")
+			end, _ := cmd.Flags().GetString("end")
+			reason, _ := cmd.Flags().GetString("reason")
+			sendCommand("add_closure", map[string]any{
+				"date":   date,
+				"end":    end,
+				"reason": reason,
+			})
+		},
+	}
+	calendarAddCmd.Flags().String("date", "", "Closed day (YYYY-MM-DD)")
+	calendarAddCmd.Flags().String("end", "", "Last closed day, to close a range of days (YYYY-MM-DD)")
+	calendarAddCmd.Flags().String("reason", "", "Why the campus is closed")
+	calendarAddCmd.MarkFlagRequired("date")
+	calendarCmd.AddCommand(calendarAddCmd)
+	calendarRemoveCmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Send remove_closure command",
+		Run: func(cmd *cobra.Command, args []string) {
+			date, _ := cmd.Flags().GetString("date")
+			sendCommand("remove_closure", map[string]any{"date": date})
+		},
+	}
+	calendarRemoveCmd.Flags().String("date", "", "Day to reopen (YYYY-MM-DD)")
+	calendarRemoveCmd.MarkFlagRequired("date")
+	calendarCmd.AddCommand(calendarRemoveCmd)
+	rootCmd.AddCommand(calendarCmd)
+
+	watchtimeCmd := &cobra.Command{
+		Use:   "watchtime",
+		Short: "Show or edit watch periods of given days",
+	}
+	watchtimeCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Send get_watchtime command",
+		Run: func(cmd *cobra.Command, args []string) {
+			sendCommand("get_watchtime", nil)
+		},
+	})
+	watchtimeSetCmd := &cobra.Command{
+		Use:   "set",
+		Short: "Send set_watchtime command",
+		Run: func(cmd *cobra.Command, args []string) {
+			date, _ := cmd.Flags().GetString("date")
+			ranges, _ := cmd.Flags().GetStringArray("period")
+			periods := [][]string{}
+			for _, period := range ranges {
+				start, end, found := strings.Cut(period, "-")
+				if !found {
+					fmt.Printf("Invalid period `%s` (expected HH:MM:SS-HH:MM:SS)\n", period)
+					os.Exit(1)
+				}
+				periods = append(periods, []string{start, end})
+			}
+			sendCommand("set_watchtime", map[string]any{
+				"date":    date,
+				"periods": periods,
+			})
+		},
+	}
+	watchtimeSetCmd.Flags().String("date", "", "Day to override (YYYY-MM-DD)")
+	watchtimeSetCmd.Flags().StringArray("period", nil, "Watch period of the day, HH:MM:SS-HH:MM:SS (repeat for several, none to watch nothing)")
+	watchtimeSetCmd.MarkFlagRequired("date")
+	watchtimeCmd.AddCommand(watchtimeSetCmd)
+	watchtimeClearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Send clear_watchtime command",
+		Run: func(cmd *cobra.Command, args []string) {
+			date, _ := cmd.Flags().GetString("date")
+			sendCommand("clear_watchtime", map[string]any{"date": date})
+		},
+	}
+	watchtimeClearCmd.Flags().String("date", "", "Day to give back its weekday periods (YYYY-MM-DD)")
+	watchtimeClearCmd.MarkFlagRequired("date")
+	watchtimeCmd.AddCommand(watchtimeClearCmd)
+	rootCmd.AddCommand(watchtimeCmd)
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "notify",
 		Short: "Send notify_students command",
@@ -152,6 +418,30 @@ func main() {
 	}
 	rootCmd.AddCommand(deletePiscinerCmd)
 
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Send get_audit command",
+		Run: func(cmd *cobra.Command, args []string) {
+			params := map[string]any{}
+			for _, name := range []string{"client", "command", "from", "to"} {
+				if value, _ := cmd.Flags().GetString(name); value != "" {
+					params[name] = value
+				}
+			}
+			if cmd.Flags().Changed("limit") {
+				limit, _ := cmd.Flags().GetInt("limit")
+				params["limit"] = limit
+			}
+			sendCommand("get_audit", params)
+		},
+	}
+	auditCmd.Flags().String("client", "", "Only show commands sent with this token name")
+	auditCmd.Flags().String("command", "", "Only show this command (e.g. delete_student)")
+	auditCmd.Flags().String("from", "", "First day to show (YYYY-MM-DD)")
+	auditCmd.Flags().String("to", "", "Last day to show (YYYY-MM-DD)")
+	auditCmd.Flags().Int("limit", 50, "Number of most recent commands to show")
+	rootCmd.AddCommand(auditCmd)
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:    "completion",
 		Short:  "Generate shell completion script",
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable string = "table"
+	outputJSON  string = "json"
+	outputCSV   string = "csv"
+)
+
+// Answer of the server to every command, Data depends on the command
+type CommandResponse struct {
+	Command string          `json:"command"`
+	OK      bool            `json:"ok"`
+	Message string          `json:"message,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type StatusData struct {
+	Campuses      []CampusStatus `json:"campuses"`
+	QueueDepth    int            `json:"queue_depth"`
+	QueueCapacity int            `json:"queue_capacity"`
+}
+
+type CampusStatus struct {
+	Campus    string `json:"campus"`
+	Timezone  string `json:"timezone"`
+	Listening bool   `json:"listening"`
+	Period    *struct {
+		Day   string `json:"day"`
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"period"`
+	Users []UserStatus `json:"users"`
+}
+
+type UserStatus struct {
+	Login42         string    `json:"login"`
+	ID42            string    `json:"id_42"`
+	ControlAccessID int       `json:"control_access_id"`
+	Profile         string    `json:"profile"`
+	IsApprentice    bool      `json:"is_apprentice"`
+	FirstAccess     time.Time `json:"first_access"`
+	LastAccess      time.Time `json:"last_access"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	Status          string    `json:"status"`
+}
+
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputCSV:
+		return nil
+	}
+	return fmt.Errorf("invalid output `%s` (expected %s, %s or %s)", format, outputTable, outputJSON, outputCSV)
+}
+
+// printResponse renders the answer of the server in the requested format
+func printResponse(format string, body []byte) error {
+	var response CommandResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("unexpected server answer: %s", strings.TrimSpace(string(body)))
+	}
+	if format == outputJSON {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(strings.TrimSpace(indented.String()))
+	}
+	if !response.OK {
+		return fmt.Errorf("%s", response.Error)
+	}
+
+	switch format {
+	case outputTable:
+		if response.Command == "get_status" {
+			return printStatusTable(response)
+		}
+		fmt.Println(strings.TrimRight(response.Message, "\n"))
+	case outputCSV:
+		if response.Command == "get_status" {
+			return printStatusCSV(response)
+		}
+		return printDataCSV(response)
+	}
+	return nil
+}
+
+func decodeStatus(response CommandResponse) (StatusData, error) {
+	var status StatusData
+	err := json.Unmarshal(response.Data, &status)
+	return status, err
+}
+
+func formatAccess(value time.Time, loc *time.Location) string {
+	if value.IsZero() {
+		return "--:--:--"
+	}
+	if loc != nil {
+		value = value.In(loc)
+	}
+	return value.Format("15:04:05")
+}
+
+func printStatusTable(response CommandResponse) error {
+	status, err := decodeStatus(response)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Event queue: %d/%d pending\n", status.QueueDepth, status.QueueCapacity)
+	for _, campus := range status.Campuses {
+		// Times are shown on campus time, when the timezone database knows it
+		loc, _ := time.LoadLocation(campus.Timezone)
+		listening := "not listening"
+		if campus.Listening {
+			listening = "listening"
+		}
+		period := "no watch period running"
+		if campus.Period != nil {
+			period = fmt.Sprintf("watch period %s [%s - %s]", campus.Period.Day, campus.Period.Start, campus.Period.End)
+		}
+		fmt.Println()
+		if campus.Campus != "" {
+			fmt.Printf("%s (%s) ┆ %s ┆ %s\n", campus.Campus, campus.Timezone, listening, period)
+		} else {
+			fmt.Printf("%s ┆ %s ┆ %s\n", campus.Timezone, listening, period)
+		}
+		if len(campus.Users) == 0 {
+			fmt.Println("No users saved")
+			continue
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "LOGIN\tPROFILE\tAPPRENTICE\tFIRST ACCESS\tLAST ACCESS\tDURATION\tSTATUS")
+		for _, user := range campus.Users {
+			apprentice := "no"
+			if user.IsApprentice {
+				apprentice = "yes"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				user.Login42, user.Profile, apprentice,
+				formatAccess(user.FirstAccess, loc), formatAccess(user.LastAccess, loc),
+				time.Duration(user.DurationSeconds)*time.Second, user.Status)
+		}
+		table.Flush()
+	}
+	return nil
+}
+
+func printStatusCSV(response CommandResponse) error {
+	status, err := decodeStatus(response)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"campus", "listening", "period_day", "period_start", "period_end", "login", "id_42", "control_access_id", "profile", "is_apprentice", "first_access", "last_access", "duration_seconds", "status"})
+	for _, campus := range status.Campuses {
+		periodDay, periodStart, periodEnd := "", "", ""
+		if campus.Period != nil {
+			periodDay, periodStart, periodEnd = campus.Period.Day, campus.Period.Start, campus.Period.End
+		}
+		for _, user := range campus.Users {
+			first, last := "", ""
+			if !user.FirstAccess.IsZero() {
+				first = user.FirstAccess.Format(time.RFC3339)
+			}
+			if !user.LastAccess.IsZero() {
+				last = user.LastAccess.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				campus.Campus, strconv.FormatBool(campus.Listening), periodDay, periodStart, periodEnd,
+				user.Login42, user.ID42, strconv.Itoa(user.ControlAccessID), user.Profile, strconv.FormatBool(user.IsApprentice),
+				first, last, strconv.FormatInt(user.DurationSeconds, 10), user.Status,
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// printDataCSV writes the data of any command as CSV: one row per item of a list, or a single row for an object.
+// Columns follow the order of the fields sent by the server, nested values are kept as JSON.
+func printDataCSV(response CommandResponse) error {
+	data := bytes.TrimSpace(response.Data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		fmt.Println(strings.TrimRight(response.Message, "\n"))
+		return nil
+	}
+	if data[0] == '{' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	columns, rows, err := decodeRows(data)
+	if err != nil || len(columns) == 0 {
+		return err
+	}
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// decodeRows reads a JSON list of objects, keeping the order in which fields first appear
+func decodeRows(data []byte) ([]string, []map[string]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, nil, err
+	}
+	var columns []string
+	known := map[string]bool{}
+	var rows []map[string]string
+	for _, item := range items {
+		row := map[string]string{}
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+			// List of plain values, like closure days
+			row["value"] = csvValue(item)
+			if !known["value"] {
+				known["value"] = true
+				columns = append(columns, "value")
+			}
+			rows = append(rows, row)
+			continue
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			key, _ := token.(string)
+			var value json.RawMessage
+			if err = decoder.Decode(&value); err != nil && err != io.EOF {
+				return nil, nil, err
+			}
+			if !known[key] {
+				known[key] = true
+				columns = append(columns, key)
+			}
+			row[key] = csvValue(value)
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+func csvValue(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text
+	}
+	if string(value) == "null" {
+		return ""
+	}
+	return string(value)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// User of a campus, as returned by /api/users
+type APIUser struct {
+	Campus string `json:"campus,omitempty"`
+	watchdog.UserStatus
+}
+
+// Attendances of a day, as returned by /api/attendance
+type APIAttendance struct {
+	Date     string                      `json:"date"`
+	Recorded []watchdog.AttendanceRecord `json:"recorded"` // Watch periods already over
+	Running  []watchdog.AttendanceRecord `json:"running"`  // Running watch period, as it would be posted if it ended now
+}
+
+// Watch period of a campus, as returned by /api/periods/current
+type APIPeriod struct {
+	Campus    string                 `json:"campus,omitempty"`
+	Timezone  string                 `json:"timezone"`
+	Now       time.Time              `json:"now"` // On campus time
+	Listening bool                   `json:"listening"`
+	Period    *watchdog.PeriodStatus `json:"period"` // Null outside watch periods
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// registerAPI adds the read-only REST API. Every endpoint but the spec needs a command token, of any role.
+func registerAPI() {
+	http.HandleFunc("GET /api/openapi.yaml", openAPIEndpoint)
+	http.Handle("GET /api/users", apiAuthMiddleware(usersEndpoint))
+	http.Handle("GET /api/users/{login}", apiAuthMiddleware(userEndpoint))
+	http.Handle("GET /api/attendance", apiAuthMiddleware(attendanceEndpoint))
+	http.Handle("GET /api/periods/current", apiAuthMiddleware(currentPeriodEndpoint))
+}
+
+func apiAuthMiddleware(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, authenticated := authenticateCommand(r); !authenticated {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "Missing or invalid token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func writeAPIResponse(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, msg string) {
+	writeAPIResponse(w, statusCode, APIError{Error: msg})
+}
+
+// apiCampuses returns the campus given in the `campus` query parameter, or every campus when none is given
+func apiCampuses(w http.ResponseWriter, r *http.Request) ([]*watchdog.Campus, bool) {
+	campuses, err := targetCampuses(map[string]any{"campus": r.URL.Query().Get("campus")})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return campuses, true
+}
+
+func campusUsers(campuses []*watchdog.Campus) []APIUser {
+	users := []APIUser{}
+	for _, campus := range campuses {
+		for _, user := range campus.Status().Users {
+			users = append(users, APIUser{Campus: campus.Name, UserStatus: user})
+		}
+	}
+	return users
+}
+
+func openAPIEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+func usersEndpoint(w http.ResponseWriter, r *http.Request) {
+	campuses, ok := apiCampuses(w, r)
+	if !ok {
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, campusUsers(campuses))
+}
+
+func userEndpoint(w http.ResponseWriter, r *http.Request) {
+	campuses, ok := apiCampuses(w, r)
+	if !ok {
+		return
+	}
+	login := r.PathValue("login")
+	for _, user := range campusUsers(campuses) {
+		if strings.EqualFold(user.Login42, login) {
+			writeAPIResponse(w, http.StatusOK, user)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, "No user with login "+login)
+}
+
+func attendanceEndpoint(w http.ResponseWriter, r *http.Request) {
+	campuses, ok := apiCampuses(w, r)
+	if !ok {
+		return
+	}
+	login := r.URL.Query().Get("login")
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(campuses[0].Location).Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid date "+date+" (expected YYYY-MM-DD)")
+		return
+	}
+
+	response := APIAttendance{Date: date, Recorded: []watchdog.AttendanceRecord{}, Running: []watchdog.AttendanceRecord{}}
+	// Without storage directory there is no history, only the running period is known
+	if config.ConfigData.Storage.Directory != "" {
+		records, err := watchdog.QueryHistory(watchdog.HistoryFilter{Campus: r.URL.Query().Get("campus"), Login: login, From: date, To: date})
+		if err != nil {
+			writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		response.Recorded = append(response.Recorded, records...)
+	}
+	for _, campus := range campuses {
+		if period := campus.CurrentPeriod(); period == nil || period.Day != date {
+			continue
+		}
+		for _, record := range campus.PreviewAttendances() {
+			if login == "" || strings.EqualFold(record.Login42, login) {
+				response.Running = append(response.Running, record)
+			}
+		}
+	}
+	writeAPIResponse(w, http.StatusOK, response)
+}
+
+func currentPeriodEndpoint(w http.ResponseWriter, r *http.Request) {
+	campuses, ok := apiCampuses(w, r)
+	if !ok {
+		return
+	}
+	periods := []APIPeriod{}
+	for _, campus := range campuses {
+		periods = append(periods, APIPeriod{
+			Campus:    campus.Name,
+			Timezone:  campus.Timezone,
+			Now:       time.Now().In(campus.Location),
+			Listening: campus.GetAllowEvents(),
+			Period:    campus.CurrentPeriod(),
+		})
+	}
+	writeAPIResponse(w, http.StatusOK, periods)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+const defaultAuditLimit = 50
+
+// Commands whose effect on users is recorded, with the value of each changed user before and after
+var auditedUserCommands = map[string]bool{
+	"stop_listen":           true,
+	"update_student_status": true,
+	"delete_student":        true,
+	"delete_all_pisciner":   true,
+}
+
+// Value of a user before and after a command. Before is nil for a created user, After for a deleted one.
+type AuditUserChange struct {
+	Campus string         `json:"campus,omitempty"`
+	Login  string         `json:"login"`
+	Before *watchdog.User `json:"before,omitempty"`
+	After  *watchdog.User `json:"after,omitempty"`
+}
+
+// One command sent to the server, as stored in the audit log
+type AuditEntry struct {
+	At         time.Time         `json:"at"`
+	Client     string            `json:"client"`
+	Role       string            `json:"role"`
+	RemoteIP   string            `json:"remote_ip"`
+	Command    string            `json:"command"`
+	Parameters map[string]any    `json:"parameters,omitempty"`
+	Status     int               `json:"status"`
+	Outcome    string            `json:"outcome"` // First line of the response
+	Changes    []AuditUserChange `json:"changes,omitempty"`
+}
+
+type AuditFilter struct {
+	Client  string // Empty for every client
+	Command string // Empty for every command
+	From    string // YYYY-MM-DD, inclusive. Empty for no lower bound
+	To      string // YYYY-MM-DD, inclusive. Empty for no upper bound
+	Limit   int    // Only the last entries are returned
+}
+
+var auditFile *os.File
+var auditMutex sync.Mutex
+
+func auditEnabled() bool {
+	return config.ConfigData.Audit.Path != ""
+}
+
+// initAuditLog opens the audit log in append mode, the server never rewrites past entries
+func initAuditLog() error {
+	if !auditEnabled() {
+		watchdog.Log("[AUDIT] ⚠️  No audit path configured, commands won't be audited")
+		return nil
+	}
+	file, err := os.OpenFile(config.ConfigData.Audit.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	auditFile = file
+	return nil
+}
+
+func closeAuditLog() {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	if auditFile != nil {
+		auditFile.Close()
+		auditFile = nil
+	}
+}
+
+// isAuditedCommand tells if a command changes the server state. Read-only and unknown commands are not audited.
+func isAuditedCommand(command string) bool {
+	role, known := commandRoles[command]
+	return known && role != config.RoleRead
+}
+
+func newAuditEntry(r *http.Request, client config.ConfigCommandToken, cmdReq CommandRequest) AuditEntry {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	return AuditEntry{
+		At:         time.Now(),
+		Client:     client.Name,
+		Role:       client.Role,
+		RemoteIP:   remoteIP,
+		Command:    cmdReq.Command,
+		Parameters: cmdReq.Parameters,
+	}
+}
+
+// auditOutcome keeps the first line of a response, skipping campus headers
+func auditOutcome(response string) string {
+	for _, line := range strings.Split(response, "\n") {
+		if line != "" && !strings.HasPrefix(line, "──") {
+			return line
+		}
+	}
+	return ""
+}
+
+func appendAuditLog(entry AuditEntry) {
+	if auditFile == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[AUDIT] ERROR: couldn't encode audit entry: %s", err.Error()))
+		return
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	if _, err = auditFile.Write(append(line, '\n')); err != nil {
+		watchdog.Log(fmt.Sprintf("[AUDIT] ERROR: couldn't write audit entry: %s", err.Error()))
+		return
+	}
+	if err = auditFile.Sync(); err != nil {
+		watchdog.Log(fmt.Sprintf("[AUDIT] ERROR: couldn't sync audit log: %s", err.Error()))
+	}
+}
+
+// snapshotCampusUsers copies the users of each campus, to compare them once a command is done
+func snapshotCampusUsers(campuses []*watchdog.Campus) map[*watchdog.Campus]map[int]watchdog.User {
+	snapshots := map[*watchdog.Campus]map[int]watchdog.User{}
+	for _, campus := range campuses {
+		snapshots[campus] = campus.SnapshotUsers()
+	}
+	return snapshots
+}
+
+// diffCampusUsers lists the users that changed since the snapshot. When login is given, other users are ignored,
+// so badge events processed while the command ran don't show up.
+func diffCampusUsers(before map[*watchdog.Campus]map[int]watchdog.User, login string) []AuditUserChange {
+	var changes []AuditUserChange
+	for campus, users := range before {
+		after := campus.SnapshotUsers()
+		ids := map[int]bool{}
+		for id := range users {
+			ids[id] = true
+		}
+		for id := range after {
+			ids[id] = true
+		}
+		for id := range ids {
+			oldUser, hadUser := users[id]
+			newUser, hasUser := after[id]
+			change := AuditUserChange{Campus: campus.Name}
+			if hadUser {
+				change.Before = &oldUser
+				change.Login = oldUser.Login42
+			}
+			if hasUser {
+				change.After = &newUser
+				change.Login = newUser.Login42
+			}
+			if login != "" && !strings.EqualFold(change.Login, login) {
+				continue
+			}
+			if hadUser && hasUser && sameUser(oldUser, newUser) {
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func sameUser(a, b watchdog.User) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+// queryAuditLog reads the audit log and returns the last entries matching the filter, oldest first
+func queryAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	if !auditEnabled() {
+		return nil, errors.New("audit is disabled (no audit path configured)")
+	}
+	file, err := os.Open(config.ConfigData.Audit.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	loc := watchdog.CampusLocation()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		day := entry.At.In(loc).Format("2006-01-02")
+		if (filter.From != "" && day < filter.From) || (filter.To != "" && day > filter.To) {
+			continue
+		}
+		if filter.Client != "" && entry.Client != filter.Client {
+			continue
+		}
+		if filter.Command != "" && entry.Command != filter.Command {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+func formatAuditLog(entries []AuditEntry) string {
+	if len(entries) == 0 {
+		return "No audited command for this filter"
+	}
+	loc := watchdog.CampusLocation()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d audited commands\n", len(entries)))
+	for _, entry := range entries {
+		params := ""
+		if len(entry.Parameters) > 0 {
+			encoded, _ := json.Marshal(entry.Parameters)
+			params = " " + string(encoded)
+		}
+		out.WriteString(fmt.Sprintf("%s %s (%s) from %s: %s%s → %d %s\n",
+			entry.At.In(loc).Format("02/01/2006 15:04:05"), entry.Client, entry.Role, entry.RemoteIP,
+			entry.Command, params, entry.Status, entry.Outcome))
+		for i, change := range entry.Changes {
+			branch := "├──"
+			if i == len(entry.Changes)-1 {
+				branch = "└──"
+			}
+			login := change.Login
+			if change.Campus != "" {
+				login = change.Campus + "/" + login
+			}
+			out.WriteString(fmt.Sprintf("    %s %s: %s → %s\n", branch, login, formatAuditUser(change.Before, loc), formatAuditUser(change.After, loc)))
+		}
+	}
+	return out.String()
+}
+
+func formatAuditUser(user *watchdog.User, loc *time.Location) string {
+	if user == nil {
+		return "none"
+	}
+	first, last := "--:--:--", "--:--:--"
+	if !user.FirstAccess.IsZero() {
+		first = user.FirstAccess.In(loc).Format("15:04:05")
+	}
+	if !user.LastAccess.IsZero() {
+		last = user.LastAccess.In(loc).Format("15:04:05")
+	}
+	return fmt.Sprintf("[apprentice=%t first=%s last=%s duration=%s status=%s]", user.IsApprentice, first, last, user.Duration.Round(time.Second), user.Status)
+}
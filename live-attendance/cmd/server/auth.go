@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"watchdog/config"
+)
+
+// Each role can send the commands of the roles below it
+var roleLevels = map[string]int{
+	config.RoleRead:     1,
+	config.RoleOperator: 2,
+	config.RoleAdmin:    3,
+}
+
+// Role needed by each command. Unknown commands are refused later on, once authenticated.
+var commandRoles = map[string]string{
+	"get_status":    config.RoleRead,
+	"get_history":   config.RoleRead,
+	"outbox_list":   config.RoleRead,
+	"get_schedule":  config.RoleRead,
+	"get_calendar":  config.RoleRead,
+	"get_watchtime": config.RoleRead,
+
+	"start_listen":    config.RoleOperator,
+	"stop_listen":     config.RoleOperator,
+	"notify_students": config.RoleOperator,
+	"outbox_retry":    config.RoleOperator,
+	"add_closure":     config.RoleOperator,
+	"remove_closure":  config.RoleOperator,
+	"set_watchtime":   config.RoleOperator,
+	"clear_watchtime": config.RoleOperator,
+
+	"update_student_status": config.RoleAdmin,
+	"delete_student":        config.RoleAdmin,
+	"delete_all_pisciner":   config.RoleAdmin,
+	"outbox_drop":           config.RoleAdmin,
+	"add_job":               config.RoleAdmin,
+	"remove_job":            config.RoleAdmin,
+	"get_audit":             config.RoleAdmin,
+}
+
+// authenticateCommand returns the client owning the bearer token of the request
+func authenticateCommand(r *http.Request) (config.ConfigCommandToken, bool) {
+	header := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" {
+		return config.ConfigCommandToken{}, false
+	}
+	var client config.ConfigCommandToken
+	matched := false
+	// Every token is compared, so the response time doesn't tell how close a guess was
+	for _, candidate := range config.ConfigData.Commands.Tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate.Token), []byte(token)) == 1 {
+			client = candidate
+			matched = true
+		}
+	}
+	return client, matched
+}
+
+// commandAllowed tells if a role can send the command
+func commandAllowed(role string, command string) bool {
+	required, known := commandRoles[command]
+	if !known {
+		return true
+	}
+	return roleLevels[role] >= roleLevels[required]
+}
@@ -1,7 +1,5 @@
 package main
 
-var webhookSecretKey string = "toto"
-
 // Represents the inner "data" object within the main "data" object
 type CAInnerData struct {
 	DeviceName  string `json:"device_name"`
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+const (
+	SIGNATURE_VALID   string = "valid"
+	SIGNATURE_INVALID string = "invalid"
+	SIGNATURE_MISSING string = "missing"
+	// Valid signature, refused by the replay protection
+	SIGNATURE_STALE    string = "stale"
+	SIGNATURE_REPLAYED string = "replayed"
+	// Valid signature, but the payload isn't JSON
+	SIGNATURE_MALFORMED string = "malformed"
+	// Valid signature, but the event couldn't be queued: access control delivers it again
+	SIGNATURE_UNQUEUED string = "unqueued"
+)
+
+const journalFilePrefix = "webhooks-"
+const journalFileSuffix = ".jsonl"
+
+// One received webhook, as stored in the journal
+type JournalEntry struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	Campus     string          `json:"campus,omitempty"` // Campus whose webhook received it, empty on single campus setups
+	RemoteAddr string          `json:"remote_addr"`
+	Signature  string          `json:"signature"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Raw        string          `json:"raw,omitempty"` // Used when the body is not valid JSON
+}
+
+var journalFile *os.File
+var journalDay string
+var journalMutex sync.Mutex
+
+func journalEnabled() bool {
+	return config.ConfigData.Journal.Directory != ""
+}
+
+func initWebhookJournal() error {
+	if !journalEnabled() {
+		return nil
+	}
+	return os.MkdirAll(config.ConfigData.Journal.Directory, 0755)
+}
+
+// rotateWebhookJournal opens the file of the given day and removes files above MaxFiles
+func rotateWebhookJournal(now time.Time) error {
+	day := now.Format("2006-01-02")
+	if journalFile != nil && journalDay == day {
+		return nil
+	}
+	if journalFile != nil {
+		journalFile.Close()
+	}
+	dir := config.ConfigData.Journal.Directory
+	file, err := os.OpenFile(filepath.Join(dir, journalFilePrefix+day+journalFileSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		journalFile = nil
+		return err
+	}
+	journalFile = file
+	journalDay = day
+
+	if config.ConfigData.Journal.MaxFiles <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, journalFilePrefix+"*"+journalFileSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for len(files) > config.ConfigData.Journal.MaxFiles {
+		watchdog.Log(fmt.Sprintf("[JOURNAL] 🗑️  Removing old webhook journal %s", files[0]))
+		os.Remove(files[0])
+		files = files[1:]
+	}
+	return nil
+}
+
+func journalWebhook(body []byte, signature string, remoteAddr string, campus string) {
+	if !journalEnabled() {
+		return
+	}
+	entry := JournalEntry{
+		ReceivedAt: time.Now(),
+		Campus:     campus,
+		RemoteAddr: remoteAddr,
+		Signature:  signature,
+	}
+	if json.Valid(body) {
+		entry.Payload = body
+	} else {
+		entry.Raw = string(body)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[JOURNAL] ERROR: couldn't encode webhook: %s", err.Error()))
+		return
+	}
+
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	if err = rotateWebhookJournal(entry.ReceivedAt); err != nil {
+		watchdog.Log(fmt.Sprintf("[JOURNAL] ERROR: couldn't open webhook journal: %s", err.Error()))
+		return
+	}
+	if _, err = journalFile.Write(append(line, '\n')); err != nil {
+		watchdog.Log(fmt.Sprintf("[JOURNAL] ERROR: couldn't write webhook journal: %s", err.Error()))
+	}
+}
+
+func closeWebhookJournal() {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	if journalFile != nil {
+		journalFile.Close()
+		journalFile = nil
+	}
+}
+
+// readJournal loads entries from a journal file, or from every journal file of a directory
+func readJournal(path string) ([]JournalEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, journalFilePrefix+"*"+journalFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var entries []JournalEntry
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var entry JournalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				watchdog.Log(fmt.Sprintf("[REPLAY] ⚠️  %s:%d: unreadable entry: %s", name, line, err.Error()))
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -11,13 +11,28 @@ import (
 )
 
 func startHTTPServer(port string) {
-	http.Handle("/webhook/access-control", verifySignatureMiddleware(http.HandlerFunc(accessControlEndpoint)))
+	// Each campus access control box sends its webhooks on its own path, signed with its own secret
+	for _, campus := range watchdog.Campuses {
+		http.Handle(campus.Webhook.Path, verifySignatureMiddleware(campus, accessControlEndpoint(campus)))
+	}
 	http.HandleFunc("/commands", commandHandler)
+	registerAPI()
 
 	watchdog.Log(fmt.Sprintf("[HTTP] Listening on port %s", port))
 	watchdog.Log("[HTTP] ┌─ Available endpoints:")
 	watchdog.Log("       ├── /commands")
-	watchdog.Log("       └── /webhook/access-control")
+	watchdog.Log("       ├── /api (spec on /api/openapi.yaml)")
+	for i, campus := range watchdog.Campuses {
+		branch := "├──"
+		if i == len(watchdog.Campuses)-1 {
+			branch = "└──"
+		}
+		if campus.Name == "" {
+			watchdog.Log(fmt.Sprintf("       %s %s", branch, campus.Webhook.Path))
+		} else {
+			watchdog.Log(fmt.Sprintf("       %s %s (%s)", branch, campus.Webhook.Path, campus.Name))
+		}
+	}
 
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		watchdog.Log(fmt.Sprintf("[HTTP] [FATAL] could not start server: %s\n", err))
@@ -29,9 +44,15 @@ func main() {
 	shutdownSignals := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignals, syscall.SIGINT, syscall.SIGTERM)
 
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+
 	if len(os.Args) <= 2 {
 		fmt.Printf("Invalid program usage:\n")
 		fmt.Printf("./watchdog <path_to_config_file> <path_to_log_file>\n")
+		fmt.Printf("./watchdog replay <journal_file_or_folder> [--date YYYY-MM-DD] [--campus name] [--config path] [--log path] [--post]\n")
 		os.Exit(1)
 	}
 
@@ -51,21 +72,65 @@ func main() {
 	}
 	watchdog.Log(fmt.Sprintf("[WATCHDOG] 📝 Initialiazed log file %s", logFile))
 	watchdog.Log(fmt.Sprintf("[WATCHDOG] 💾 Loading config using file %s", configFile))
-	config.LoadConfig(configFile)
+	err = config.LoadConfig(configFile)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[WATCHDOG] ERROR: couldn't load config: %s", err.Error()))
+		os.Exit(1)
+	}
 	err = watchdog.InitAPIs()
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 		return
 	}
-	watchdog.AllowEvents(true)
+	err = watchdog.RestoreState()
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[STATE] ERROR: %s", err.Error()))
+		os.Exit(1)
+	}
+	for _, campus := range watchdog.Campuses {
+		go campus.LoadRoster()
+	}
+	watchdog.StartWatchtimeScheduler()
+	err = watchdog.StartScheduler()
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[SCHEDULE] ERROR: %s", err.Error()))
+		os.Exit(1)
+	}
+	err = initWebhookJournal()
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[JOURNAL] ERROR: couldn't create webhook journal directory: %s", err.Error()))
+		os.Exit(1)
+	}
+	err = initAuditLog()
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[AUDIT] ERROR: couldn't open audit log: %s", err.Error()))
+		os.Exit(1)
+	}
+	watchdog.StartEventQueue()
 	go startHTTPServer("8042")
 
 	// Wait a SIGINT or SIGTERM signal to stop
 	sig := <-shutdownSignals
 	fmt.Printf("\n") // Used to not display log on the same line as ^C
 	watchdog.Log(fmt.Sprintf("Received signal: %v. Starting graceful shutdown...", sig))
-	watchdog.PostApprenticesAttendances()
+	// No watch period is closed nor job run behind the final post
+	watchdog.StopWatchtimeScheduler()
+	watchdog.StopScheduler()
+	// Events already accepted must be counted before the final post
+	watchdog.DrainEventQueue()
+	for _, campus := range watchdog.Campuses {
+		if watchdog.StateEnabled() && campus.IsPeriodOngoing() {
+			// The day will be resumed from the state store on next boot
+			campus.Log("[STATE] 💾 Watch period still running, keeping attendances for next boot")
+		} else {
+			campus.PostApprenticesAttendances()
+		}
+	}
 	watchdog.AllowEvents(false)
+	watchdog.CloseState()
+	watchdog.CloseHistory()
+	closeWebhookJournal()
+	closeAuditLog()
 	watchdog.Log("Watchdog shut down successfully")
 	watchdog.Log("")
 	watchdog.CloseLogs()
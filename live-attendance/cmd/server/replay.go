@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+type replayEvent struct {
+	Payload CAPayload
+	Time    time.Time
+	Campus  string
+}
+
+func replayUsage() {
+	fmt.Printf("Invalid program usage:\n")
+	fmt.Printf("./watchdog replay <journal_file_or_folder> [--date YYYY-MM-DD] [--campus name] [--config path] [--log path] [--post]\n")
+	os.Exit(1)
+}
+
+// runReplay feeds journaled webhooks back through the attendance engine
+func runReplay(args []string) {
+	if len(args) < 1 || args[0] == "" || args[0][0] == '-' {
+		replayUsage()
+	}
+	journalPath := args[0]
+
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	date := flags.String("date", "", "Only replay events of this day (YYYY-MM-DD)")
+	campusName := flags.String("campus", "", "Only replay events of this campus")
+	configFile := flags.String("config", "/etc/watchdog/config.yml", "Path to config file")
+	logFile := flags.String("log", "/var/log/42watchdog/replay.log", "Path to log file")
+	post := flags.Bool("post", false, "Post rebuilt attendances to Chronos and send report mails")
+	flags.Parse(args[1:])
+
+	var day time.Time
+	if *date != "" {
+		var err error
+		day, err = time.Parse("2006-01-02", *date)
+		if err != nil {
+			fmt.Printf("Invalid date format: '%s'. Expected format: YYYY-MM-DD\n", *date)
+			os.Exit(1)
+		}
+	}
+
+	err := watchdog.InitLogs(*logFile)
+	if err != nil {
+		fmt.Printf("ERROR: couldn't init logs")
+		os.Exit(1)
+	}
+	defer watchdog.CloseLogs()
+	watchdog.Log(fmt.Sprintf("[REPLAY] 💾 Loading config using file %s", *configFile))
+	err = config.LoadConfig(*configFile)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[REPLAY] ERROR: %s", err.Error()))
+		os.Exit(1)
+	}
+
+	// Replay must never touch the live server state, but uses the runtime closures and watchtime overrides
+	// of the storage directory so periods match the live server
+	watchdog.SetStorageReadOnly(true)
+	if !*post {
+		config.ConfigData.Attendance42.AutoPost = false
+		watchdog.SetMailReports(false)
+	}
+
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[REPLAY] ERROR: couldn't read journal: %s", err.Error()))
+		os.Exit(1)
+	}
+	events := filterReplayEvents(entries, day, *campusName)
+	watchdog.Log(fmt.Sprintf("[REPLAY] 📼 %d journal entries read, %d events to replay", len(entries), len(events)))
+	if len(events) == 0 {
+		return
+	}
+
+	err = watchdog.InitAPIs()
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[REPLAY] ERROR: %s", err.Error()))
+		os.Exit(1)
+	}
+	watchdog.AllowEvents(true)
+	var replayed []*watchdog.Campus
+	count := 0
+	for _, event := range events {
+		campus, err := watchdog.GetCampus(event.Campus)
+		if err != nil {
+			watchdog.Log(fmt.Sprintf("[REPLAY] ⚠️  %s", err.Error()))
+			continue
+		}
+		// The after midnight part of a night period belongs to the day it started
+		if !day.IsZero() && campus.EventDay(event.Time).Format("2006-01-02") != day.Format("2006-01-02") {
+			continue
+		}
+		if !slices.Contains(replayed, campus) {
+			replayed = append(replayed, campus)
+		}
+		count++
+		campus.UpdateUserAccess(*event.Payload.Data.User, event.Payload.Data.Event.UserName, event.Time, event.Payload.Data.Event.DoorName, event.Payload.Data.Event.DeviceName)
+	}
+	for _, campus := range replayed {
+		campus.PrintUsersTimers()
+		if *post {
+			campus.PostApprenticesAttendances()
+		}
+	}
+	watchdog.Log(fmt.Sprintf("[REPLAY] ✅ Replay done, %d events replayed", count))
+}
+
+// replayCampus returns the campus config a journal entry belongs to.
+// Entries journaled before campuses had names belong to the first campus.
+func replayCampus(name string) (config.ConfigCampus, bool) {
+	for _, campus := range config.ConfigData.Campuses {
+		if campus.Name == name {
+			return campus, true
+		}
+	}
+	if name == "" {
+		return config.ConfigData.Campuses[0], true
+	}
+	return config.ConfigCampus{}, false
+}
+
+// filterReplayEvents keeps the events the webhook endpoint would have processed, sorted by event time.
+// With a campus name, only the events of this campus are kept. With a day, the events of this day and of
+// the next one are kept, the latter may belong to a night period started on day.
+// A payload journaled twice as valid (journals written before unqueued deliveries were told apart) is replayed once.
+func filterReplayEvents(entries []JournalEntry, day time.Time, campusName string) []replayEvent {
+	var events []replayEvent
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Signature != SIGNATURE_VALID || len(entry.Payload) == 0 {
+			continue
+		}
+		key := entry.Campus + "|" + string(entry.Payload)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		campus, known := replayCampus(entry.Campus)
+		if !known {
+			watchdog.Log(fmt.Sprintf("[REPLAY] ⚠️  Skipping event of unknown campus `%s`", entry.Campus))
+			continue
+		}
+		if campusName != "" && campus.Name != campusName {
+			continue
+		}
+		var payload CAPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			continue
+		}
+		if payload.Data.Code != 48 || payload.Data.User == nil {
+			continue
+		}
+		eventTime, err := parseEventTime(payload.Data.DateTime, campus.Location)
+		if err != nil {
+			watchdog.Log(fmt.Sprintf("[REPLAY] ⚠️  Couldn't parse event time '%s'", payload.Data.DateTime))
+			continue
+		}
+		if eventDate := eventTime.Format("2006-01-02"); !day.IsZero() && eventDate != day.Format("2006-01-02") && eventDate != day.AddDate(0, 0, 1).Format("2006-01-02") {
+			continue
+		}
+		events = append(events, replayEvent{Payload: payload, Time: eventTime, Campus: campus.Name})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"watchdog/watchdog"
+)
+
+// Answer to every command. Message is the human readable output, Data the typed one.
+type CommandResponse struct {
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Data of get_status
+type StatusData struct {
+	Campuses      []watchdog.CampusStatus `json:"campuses"`
+	QueueDepth    int                     `json:"queue_depth"`
+	QueueCapacity int                     `json:"queue_capacity"`
+}
+
+// Data of outbox_retry
+type OutboxRetryData struct {
+	Posted  int `json:"posted"`
+	Pending int `json:"pending"`
+}
+
+// Data of get_watchtime
+type CampusClosures struct {
+	Campus   string             `json:"campus,omitempty"`
+	Closures []watchdog.Closure `json:"closures"`
+}
+
+type CampusWatchtimeOverrides struct {
+	Campus    string                       `json:"campus,omitempty"`
+	Overrides []watchdog.WatchtimeOverride `json:"overrides"`
+}
+
+// Data of notify_students
+type CampusNotifySummary struct {
+	Campus string `json:"campus,omitempty"`
+	watchdog.NotifySummary
+}
+
+func writeCommandResponse(w http.ResponseWriter, statusCode int, response CommandResponse) {
+	response.OK = statusCode < http.StatusBadRequest
+	if !response.OK && response.Error == "" {
+		response.Error, response.Message = response.Message, ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeCommandError answers a command refused before being run
+func writeCommandError(w http.ResponseWriter, statusCode int, command string, msg string) {
+	writeCommandResponse(w, statusCode, CommandResponse{Command: command, Error: msg})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+const (
+	defaultWebhookTolerance    = 5 * time.Minute
+	defaultWebhookReplayWindow = 15 * time.Minute
+)
+
+// Secrets accepted on one webhook. Those of the secret file are read again when the file changes,
+// so a secret can be rotated without restarting the server.
+type webhookSecrets struct {
+	static      []string
+	file        string
+	fileModTime time.Time
+	fileSecrets []string
+	mutex       sync.Mutex
+}
+
+func newWebhookSecrets(webhook config.ConfigWebhook) *webhookSecrets {
+	return &webhookSecrets{static: webhook.Secrets, file: webhook.SecretFile}
+}
+
+// current returns every accepted secret. If the file can't be read anymore, the last secrets read are kept.
+func (secrets *webhookSecrets) current() []string {
+	if secrets.file == "" {
+		return secrets.static
+	}
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+
+	info, err := os.Stat(secrets.file)
+	if err != nil {
+		watchdog.Log(fmt.Sprintf("[WEBHOOK] ⚠️  Couldn't read secret file %s, keeping previous secrets: %s", secrets.file, err.Error()))
+	} else if !info.ModTime().Equal(secrets.fileModTime) {
+		fileSecrets, err := config.ReadSecretFile(secrets.file)
+		if err != nil {
+			watchdog.Log(fmt.Sprintf("[WEBHOOK] ⚠️  Couldn't read secret file %s, keeping previous secrets: %s", secrets.file, err.Error()))
+		} else {
+			if !secrets.fileModTime.IsZero() {
+				watchdog.Log(fmt.Sprintf("[WEBHOOK] 🔑 Reloaded %d secrets from %s", len(fileSecrets), secrets.file))
+			}
+			secrets.fileSecrets = fileSecrets
+			secrets.fileModTime = info.ModTime()
+		}
+	}
+	return append(append([]string{}, secrets.static...), secrets.fileSecrets...)
+}
+
+// verify tells if the signature matches the body with one of the accepted secrets
+func (secrets *webhookSecrets) verify(body []byte, signature string) bool {
+	valid := false
+	for _, secret := range secrets.current() {
+		mac := hmac.New(sha512.New, []byte(secret))
+		mac.Write(body)
+		calculatedSigHex := hex.EncodeToString(mac.Sum(nil))
+		// Every secret is checked, so the response time doesn't tell which one matched
+		if hmac.Equal([]byte(calculatedSigHex), []byte(strings.ToLower(signature))) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// Signatures of the webhooks received recently, a webhook sent twice is a replay
+var seenSignatures = map[string]time.Time{}
+var seenSignaturesMutex sync.Mutex
+
+// markSignatureSeen records a signature, and returns false if it was already seen within the replay window
+func markSignatureSeen(signature string, now time.Time) bool {
+	seenSignaturesMutex.Lock()
+	defer seenSignaturesMutex.Unlock()
+
+	window := webhookReplayWindow()
+	for seen, at := range seenSignatures {
+		if now.Sub(at) > window {
+			delete(seenSignatures, seen)
+		}
+	}
+	signature = strings.ToLower(signature)
+	if _, found := seenSignatures[signature]; found {
+		return false
+	}
+	seenSignatures[signature] = now
+	return true
+}
+
+// forgetSignature removes a signature, so the same webhook can be delivered again
+func forgetSignature(signature string) {
+	seenSignaturesMutex.Lock()
+	defer seenSignaturesMutex.Unlock()
+	delete(seenSignatures, strings.ToLower(signature))
+}
+
+func webhookTolerance() time.Duration {
+	if config.ConfigData.Webhook.Tolerance == "" {
+		return defaultWebhookTolerance
+	}
+	tolerance, err := time.ParseDuration(config.ConfigData.Webhook.Tolerance)
+	if err != nil || tolerance < 0 {
+		return defaultWebhookTolerance
+	}
+	return tolerance
+}
+
+func webhookReplayWindow() time.Duration {
+	window, err := time.ParseDuration(config.ConfigData.Webhook.ReplayWindow)
+	if err != nil || window <= 0 {
+		window = defaultWebhookReplayWindow
+	}
+	// A signature must be remembered as long as its payload datetime is accepted
+	if tolerance := webhookTolerance(); 2*tolerance > window {
+		window = 2 * tolerance
+	}
+	return window
+}
+
+// checkEventFreshness tells if the payload datetime is within the tolerance window around its reception
+func checkEventFreshness(dateTime string, loc *time.Location, receivedAt time.Time) error {
+	tolerance := webhookTolerance()
+	if tolerance == 0 {
+		return nil
+	}
+	sentAt, err := parseEventTime(dateTime, loc)
+	if err != nil {
+		return fmt.Errorf("invalid datetime '%s'", dateTime)
+	}
+	gap := receivedAt.Sub(sentAt)
+	if gap > tolerance || gap < -tolerance {
+		return fmt.Errorf("datetime %s is %s away from reception, tolerance is %s", dateTime, gap.Round(time.Second), tolerance)
+	}
+	return nil
+}
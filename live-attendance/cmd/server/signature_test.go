@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"watchdog/config"
+	"watchdog/watchdog"
+)
+
+func sign(secret string, body string) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSecretsVerify(t *testing.T) {
+	body := `{"datetime":"2026-10-15 08:00:00"}`
+	secrets := newWebhookSecrets(config.ConfigWebhook{Secrets: []string{"new-secret", "old-secret"}})
+	tests := []struct {
+		name      string
+		signature string
+		want      bool
+	}{
+		{name: "new secret", signature: sign("new-secret", body), want: true},
+		{name: "rotated secret still accepted", signature: sign("old-secret", body), want: true},
+		{name: "uppercase signature", signature: strings.ToUpper(sign("new-secret", body)), want: true},
+		{name: "retired secret", signature: sign("retired-secret", body)},
+		{name: "signature of another body", signature: sign("new-secret", body+" ")},
+		{name: "empty signature"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := secrets.verify([]byte(body), test.signature); got != test.want {
+				t.Fatalf("verify() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWebhookSecretFileRotation(t *testing.T) {
+	body := `{"datetime":"2026-10-15 08:00:00"}`
+	path := filepath.Join(t.TempDir(), "webhook-secrets")
+	writeSecrets := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	secrets := newWebhookSecrets(config.ConfigWebhook{Secrets: []string{"static-secret"}, SecretFile: path})
+	steps := []struct {
+		name   string
+		update func()
+		want   map[string]bool
+	}{
+		{
+			name:   "secret of the file",
+			update: func() { writeSecrets("# current\nold-secret\n", start) },
+			want:   map[string]bool{"static-secret": true, "old-secret": true, "new-secret": false},
+		},
+		{
+			name:   "rotation keeps both secrets",
+			update: func() { writeSecrets("old-secret\nnew-secret\n", start.Add(time.Second)) },
+			want:   map[string]bool{"static-secret": true, "old-secret": true, "new-secret": true},
+		},
+		{
+			name:   "old secret retired",
+			update: func() { writeSecrets("new-secret\n", start.Add(2*time.Second)) },
+			want:   map[string]bool{"static-secret": true, "old-secret": false, "new-secret": true},
+		},
+		{
+			name:   "empty file keeps the previous secrets",
+			update: func() { writeSecrets("\n", start.Add(3*time.Second)) },
+			want:   map[string]bool{"static-secret": true, "old-secret": false, "new-secret": true},
+		},
+		{
+			name:   "missing file keeps the previous secrets",
+			update: func() { os.Remove(path) },
+			want:   map[string]bool{"static-secret": true, "old-secret": false, "new-secret": true},
+		},
+	}
+	for _, step := range steps {
+		step.update()
+		for secret, want := range step.want {
+			if got := secrets.verify([]byte(body), sign(secret, body)); got != want {
+				t.Fatalf("%s: verify() with %s = %v, want %v", step.name, secret, got, want)
+			}
+		}
+	}
+}
+
+func TestVerifySignatureMiddleware(t *testing.T) {
+	// One webhook sent to the middleware, the handler behind it answers handlerStatus
+	type delivery struct {
+		method        string
+		secret        string // Signs the body, no signature header when empty
+		user          int    // Makes the body, and so its signature, unique
+		age           time.Duration
+		raw           string // Body sent instead of a payload
+		handlerStatus int
+		wantStatus    int
+	}
+	tests := []struct {
+		name       string
+		deliveries []delivery
+	}{
+		{
+			name:       "valid signature",
+			deliveries: []delivery{{secret: "new-secret", user: 1, wantStatus: http.StatusOK}},
+		},
+		{
+			name: "rotated secrets both accepted",
+			deliveries: []delivery{
+				{secret: "old-secret", user: 1, wantStatus: http.StatusOK},
+				{secret: "new-secret", user: 2, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name:       "method not allowed",
+			deliveries: []delivery{{method: http.MethodGet, secret: "new-secret", user: 1, wantStatus: http.StatusMethodNotAllowed}},
+		},
+		{
+			name:       "missing signature",
+			deliveries: []delivery{{user: 1, wantStatus: http.StatusUnauthorized}},
+		},
+		{
+			name:       "unknown secret",
+			deliveries: []delivery{{secret: "retired-secret", user: 1, wantStatus: http.StatusForbidden}},
+		},
+		{
+			name:       "malformed payload",
+			deliveries: []delivery{{secret: "new-secret", raw: "not json", wantStatus: http.StatusBadRequest}},
+		},
+		{
+			name:       "stale payload",
+			deliveries: []delivery{{secret: "new-secret", user: 1, age: time.Hour, wantStatus: http.StatusForbidden}},
+		},
+		{
+			name:       "payload from the future",
+			deliveries: []delivery{{secret: "new-secret", user: 1, age: -time.Hour, wantStatus: http.StatusForbidden}},
+		},
+		{
+			name: "replayed signature",
+			deliveries: []delivery{
+				{secret: "new-secret", user: 1, wantStatus: http.StatusOK},
+				{secret: "new-secret", user: 1, wantStatus: http.StatusConflict},
+			},
+		},
+		{
+			name: "replayed signature of a rotated secret",
+			deliveries: []delivery{
+				{secret: "old-secret", user: 1, wantStatus: http.StatusOK},
+				{secret: "old-secret", user: 1, wantStatus: http.StatusConflict},
+			},
+		},
+		{
+			name: "rejected delivery doesn't count as seen",
+			deliveries: []delivery{
+				{secret: "new-secret", user: 1, age: time.Hour, wantStatus: http.StatusForbidden},
+				{secret: "new-secret", user: 1, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "unqueued event can be delivered again",
+			deliveries: []delivery{
+				{secret: "new-secret", user: 1, handlerStatus: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable},
+				{secret: "new-secret", user: 1, wantStatus: http.StatusOK},
+				{secret: "new-secret", user: 1, wantStatus: http.StatusConflict},
+			},
+		},
+	}
+
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.Journal.Directory = ""
+	config.ConfigData.Webhook.Tolerance = ""
+	config.ConfigData.Webhook.ReplayWindow = ""
+	campus := &watchdog.Campus{ConfigCampus: config.ConfigCampus{
+		Name:     "test",
+		Location: time.UTC,
+		Webhook:  config.ConfigWebhook{Secrets: []string{"new-secret", "old-secret"}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seenSignaturesMutex.Lock()
+			seenSignatures = map[string]time.Time{}
+			seenSignaturesMutex.Unlock()
+
+			now := time.Now().In(time.UTC)
+			var handlerStatus int
+			handler := verifySignatureMiddleware(campus, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(handlerStatus)
+			}))
+			for i, sent := range test.deliveries {
+				body := sent.raw
+				if body == "" {
+					dateTime := now.Add(-sent.age).Format("2006-01-02 15:04:05")
+					body = fmt.Sprintf(`{"datetime":"%s","data":{"date_time":"%s","user":%d}}`, dateTime, dateTime, sent.user)
+				}
+				method := sent.method
+				if method == "" {
+					method = http.MethodPost
+				}
+				request := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+				if sent.secret != "" {
+					request.Header.Set("x-webhook-signature", sign(sent.secret, body))
+				}
+				handlerStatus = sent.handlerStatus
+				if handlerStatus == 0 {
+					handlerStatus = http.StatusOK
+				}
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+				if response.Code != sent.wantStatus {
+					t.Fatalf("delivery %d answered %d, want %d", i+1, response.Code, sent.wantStatus)
+				}
+			}
+		})
+	}
+}
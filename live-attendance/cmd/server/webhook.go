@@ -2,37 +2,35 @@ package main
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+	"watchdog/config"
 	"watchdog/watchdog"
 )
 
 // Handler for the /command endpoint
 func commandHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		rejectCommand(w, newAuditEntry(r, config.ConfigCommandToken{}, CommandRequest{}), http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	// TODO: Add Authentication/Authorization here!
-	// This endpoint should be protected (e.g., API key, Basic Auth, IP restriction)
-	// Example: Check for a specific header/token
-	// apiKey := r.Header.Get("X-Admin-Token")
-	// if apiKey != "your-secure-admin-token" {
-	//     http.Error(w, "Unauthorized", http.StatusUnauthorized)
-	//     return
-	// }
+	client, authenticated := authenticateCommand(r)
+	if !authenticated {
+		watchdog.Log(fmt.Sprintf("[CLI] ⛔ Rejected command from %s: missing or unknown token", r.RemoteAddr))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		rejectCommand(w, newAuditEntry(r, client, CommandRequest{}), http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
 
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		rejectCommand(w, newAuditEntry(r, client, CommandRequest{}), http.StatusInternalServerError, "Error reading request body")
 		return
 	}
 	defer r.Body.Close()
@@ -40,17 +38,37 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 	var cmdReq CommandRequest
 	err = json.Unmarshal(bodyBytes, &cmdReq)
 	if err != nil {
-		http.Error(w, "Invalid command format (expecting JSON with 'command' field)", http.StatusBadRequest)
+		rejectCommand(w, newAuditEntry(r, client, CommandRequest{}), http.StatusBadRequest, "Invalid command format (expecting JSON with 'command' field)")
+		return
+	}
+
+	audit := newAuditEntry(r, client, cmdReq)
+	if !commandAllowed(client.Role, cmdReq.Command) {
+		watchdog.Log(fmt.Sprintf("[CLI] ⛔ Rejected command %s from %s: requires role %s, has %s", cmdReq.Command, client.Name, commandRoles[cmdReq.Command], client.Role))
+		rejectCommand(w, audit, http.StatusForbidden, fmt.Sprintf("Command %s requires role %s", cmdReq.Command, commandRoles[cmdReq.Command]))
 		return
 	}
 
-	watchdog.Log(fmt.Sprintf("[CLI] 🛠️  Received command: %s", cmdReq.Command))
+	watchdog.Log(fmt.Sprintf("[CLI] 🛠️  Received command: %s (from %s)", cmdReq.Command, client.Name))
+	// Commands apply to the campus given as parameter, or to every campus
+	campuses, err := targetCampuses(cmdReq.Parameters)
+	if err != nil {
+		rejectCommand(w, audit, http.StatusBadRequest, err.Error())
+		return
+	}
+	var usersBefore map[*watchdog.Campus]map[int]watchdog.User
+	if auditedUserCommands[cmdReq.Command] {
+		usersBefore = snapshotCampusUsers(campuses)
+	}
 	responseMessage := ""
+	var responseData any
 	statusCode := http.StatusOK
 	// Process the command
 	switch cmdReq.Command {
 	case "start_listen":
-		watchdog.AllowEvents(true)
+		for _, campus := range campuses {
+			campus.AllowEvents(true)
+		}
 		responseMessage = "Enabled listening hooks (Check server logs for more details)"
 	case "stop_listen":
 		shouldPost := false
@@ -62,9 +80,13 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		watchdog.AllowEvents(false)
+		for _, campus := range campuses {
+			campus.AllowEvents(false)
+			if shouldPost {
+				campus.PostApprenticesAttendances()
+			}
+		}
 		if shouldPost {
-			watchdog.PostApprenticesAttendances()
 			responseMessage = "Disabled listening hooks and posted attendances (Check server logs for more details)"
 		} else {
 			responseMessage = "Disabled listening hooks (Check server logs for more details)"
@@ -88,17 +110,23 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case !hasLogin:
 			watchdog.Log("[CLI] 🔁 Refetching all student's alternance status")
-			watchdog.RefetchAllStudents()
+			for _, campus := range campuses {
+				campus.RefetchAllStudents()
+			}
 			responseMessage = "Triggered full alternant status refresh"
 
 		case hasLogin && !hasIsAlternant:
 			watchdog.Log(fmt.Sprintf("[CLI] 🔄 Refetching status for student: %s", login))
-			watchdog.RefetchStudent(login)
+			for _, campus := range campuses {
+				campus.RefetchStudent(login)
+			}
 			responseMessage = fmt.Sprintf("Refetched status for %s", login)
 
 		case hasLogin && hasIsAlternant:
 			watchdog.Log(fmt.Sprintf("[CLI] 🔧 Forcing status of %s to alternant=%t", login, isAlternant))
-			watchdog.UpdateStudent(login, isAlternant)
+			for _, campus := range campuses {
+				campus.UpdateStudent(login, isAlternant)
+			}
 			responseMessage = fmt.Sprintf("Forced status for %s to alternant=%t", login, isAlternant)
 
 		default:
@@ -123,7 +151,9 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 
 		switch {
 		case hasLogin:
-			watchdog.DeleteStudent(login, withPost)
+			for _, campus := range campuses {
+				campus.DeleteStudent(login, withPost)
+			}
 			responseMessage = fmt.Sprintf("Deleted student %s", login)
 
 		default:
@@ -132,25 +162,397 @@ func commandHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case "delete_all_pisciner":
-		watchdog.DeleteAllPisciners()
+		for _, campus := range campuses {
+			campus.DeleteAllPisciners()
+		}
+		responseMessage = "Deleted all pisciners"
 	case "get_status":
-		watchdog.PrintUsersTimers()
-		responseMessage = "Check server logs for status detail"
+		for _, campus := range campuses {
+			campus.PrintUsersTimers()
+		}
+		depth, capacity := watchdog.EventQueueDepth()
+		status := StatusData{QueueDepth: depth, QueueCapacity: capacity}
+		for _, campus := range campuses {
+			status.Campuses = append(status.Campuses, campus.Status())
+		}
+		responseData = status
+		responseMessage = fmt.Sprintf("Event queue: %d/%d pending", depth, capacity)
+	case "get_history":
+		filter := watchdog.HistoryFilter{}
+		if params := cmdReq.Parameters; params != nil {
+			filter.Campus, _ = params["campus"].(string)
+			filter.Login, _ = params["login"].(string)
+			filter.From, _ = params["from"].(string)
+			filter.To, _ = params["to"].(string)
+		}
+		records, err := watchdog.QueryHistory(filter)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+		responseMessage = formatHistory(records)
+		responseData = records
+	case "outbox_list":
+		entries, err := watchdog.ListOutbox()
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+		responseMessage = formatOutbox(entries)
+		responseData = entries
+	case "outbox_retry":
+		var id uint64
+		if params := cmdReq.Parameters; params != nil {
+			if rawID, ok := params["id"].(float64); ok {
+				id = uint64(rawID)
+			}
+		}
+		posted, pending, err := watchdog.RetryOutbox(id, true)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Posted %d delayed attendances, %d still pending", posted, pending)
+		responseData = OutboxRetryData{Posted: posted, Pending: pending}
+	case "outbox_drop":
+		rawID, ok := cmdReq.Parameters["id"].(float64)
+		if !ok {
+			responseMessage = "You must provide the id of the outbox entry to drop"
+			statusCode = http.StatusBadRequest
+			break
+		}
+		err := watchdog.DropOutboxEntry(uint64(rawID))
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Dropped outbox entry %d", uint64(rawID))
+	case "get_schedule":
+		jobs := watchdog.GetSchedule()
+		responseMessage = formatSchedule(jobs)
+		responseData = jobs
+	case "add_job":
+		definition := config.ConfigJob{}
+		if params := cmdReq.Parameters; params != nil {
+			definition.Time, _ = params["time"].(string)
+			definition.Action, _ = params["action"].(string)
+			definition.Campus, _ = params["campus"].(string)
+			if days, ok := params["days"].([]any); ok {
+				for _, day := range days {
+					if name, ok := day.(string); ok {
+						definition.Days = append(definition.Days, name)
+					}
+				}
+			}
+		}
+		job, err := watchdog.AddScheduledJob(definition)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Added job %s", job)
+		responseData = job
+	case "remove_job":
+		rawID, ok := cmdReq.Parameters["id"].(float64)
+		if !ok {
+			responseMessage = "You must provide the id of the job to remove"
+			statusCode = http.StatusBadRequest
+			break
+		}
+		err := watchdog.RemoveScheduledJob(int(rawID))
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Removed job #%d", int(rawID))
+	case "get_calendar":
+		var calendars []CampusClosures
+		for _, campus := range campuses {
+			closures := campus.ListClosures()
+			responseMessage += campusHeader(campus) + formatCalendar(closures)
+			calendars = append(calendars, CampusClosures{Campus: campus.Name, Closures: closures})
+		}
+		responseData = calendars
+	case "add_closure":
+		definition := config.ConfigClosure{}
+		if params := cmdReq.Parameters; params != nil {
+			definition.Date, _ = params["date"].(string)
+			definition.End, _ = params["end"].(string)
+			definition.Reason, _ = params["reason"].(string)
+		}
+		var calendars []CampusClosures
+		for _, campus := range campuses {
+			days, err := campus.AddClosure(definition)
+			if err != nil {
+				responseMessage += campusHeader(campus) + err.Error() + "\n"
+				statusCode = http.StatusBadRequest
+				continue
+			}
+			responseMessage += campusHeader(campus) + fmt.Sprintf("Campus closed on %d days\n", len(days))
+			calendars = append(calendars, CampusClosures{Campus: campus.Name, Closures: days})
+		}
+		responseData = calendars
+	case "remove_closure":
+		date, _ := cmdReq.Parameters["date"].(string)
+		for _, campus := range campuses {
+			if err := campus.RemoveClosure(date); err != nil {
+				responseMessage += campusHeader(campus) + err.Error() + "\n"
+				statusCode = http.StatusBadRequest
+				continue
+			}
+			responseMessage += campusHeader(campus) + fmt.Sprintf("Campus reopened on %s\n", date)
+		}
+	case "get_watchtime":
+		var overrides []CampusWatchtimeOverrides
+		for _, campus := range campuses {
+			campusOverrides := campus.ListWatchtimeOverrides()
+			responseMessage += campusHeader(campus) + formatWatchtimeOverrides(campusOverrides)
+			overrides = append(overrides, CampusWatchtimeOverrides{Campus: campus.Name, Overrides: campusOverrides})
+		}
+		responseData = overrides
+	case "set_watchtime":
+		campus, err := singleCampus(cmdReq.Parameters)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		date, _ := cmdReq.Parameters["date"].(string)
+		periods := [][]string{}
+		if ranges, ok := cmdReq.Parameters["periods"].([]any); ok {
+			for _, rawRange := range ranges {
+				bounds, _ := rawRange.([]any)
+				period := []string{}
+				for _, bound := range bounds {
+					value, _ := bound.(string)
+					period = append(period, value)
+				}
+				periods = append(periods, period)
+			}
+		}
+		override, err := campus.SetWatchtimeOverride(date, periods)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Watchtime of %s set to %s", override.Date, override)
+		responseData = override
+	case "clear_watchtime":
+		campus, err := singleCampus(cmdReq.Parameters)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		date, _ := cmdReq.Parameters["date"].(string)
+		err = campus.ClearWatchtimeOverride(date)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusBadRequest
+			break
+		}
+		responseMessage = fmt.Sprintf("Watchtime of %s is back to its weekday periods", date)
 	case "notify_students":
-		statusCode = http.StatusNotImplemented
-		responseMessage = "Coming soon"
+		var summaries []CampusNotifySummary
+		for _, campus := range campuses {
+			summary := campus.NotifyStudents()
+			responseMessage += campusHeader(campus) + formatNotifySummary(summary)
+			summaries = append(summaries, CampusNotifySummary{Campus: campus.Name, NotifySummary: summary})
+		}
+		responseData = summaries
+	case "get_audit":
+		filter := AuditFilter{}
+		if params := cmdReq.Parameters; params != nil {
+			filter.Client, _ = params["client"].(string)
+			filter.Command, _ = params["command"].(string)
+			filter.From, _ = params["from"].(string)
+			filter.To, _ = params["to"].(string)
+			if limit, ok := params["limit"].(float64); ok {
+				filter.Limit = int(limit)
+			}
+		}
+		entries, err := queryAuditLog(filter)
+		if err != nil {
+			responseMessage = err.Error()
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+		responseMessage = formatAuditLog(entries)
+		responseData = entries
 	default:
 		responseMessage = fmt.Sprintf("Unknown command: %s", cmdReq.Command)
 		statusCode = http.StatusBadRequest
 	}
 
-	// Send response
-	w.WriteHeader(statusCode)
-	fmt.Fprint(w, responseMessage)
+	// Rejected commands are always kept, read ones included
+	if isAuditedCommand(cmdReq.Command) || statusCode >= http.StatusBadRequest {
+		audit.Status = statusCode
+		audit.Outcome = auditOutcome(responseMessage)
+		if usersBefore != nil {
+			login, _ := cmdReq.Parameters["login"].(string)
+			audit.Changes = diffCampusUsers(usersBefore, login)
+		}
+		appendAuditLog(audit)
+	}
+
+	writeCommandResponse(w, statusCode, CommandResponse{Command: cmdReq.Command, Message: responseMessage, Data: responseData})
+}
+
+// rejectCommand answers a refused command with an error, and keeps it in the audit log
+func rejectCommand(w http.ResponseWriter, audit AuditEntry, statusCode int, msg string) {
+	audit.Status = statusCode
+	audit.Outcome = msg
+	appendAuditLog(audit)
+	writeCommandError(w, statusCode, audit.Command, msg)
+}
+
+// targetCampuses returns the campus given in the `campus` parameter, or every campus when none is given
+func targetCampuses(params map[string]any) ([]*watchdog.Campus, error) {
+	name, _ := params["campus"].(string)
+	if name == "" {
+		return watchdog.Campuses, nil
+	}
+	campus, err := watchdog.GetCampus(name)
+	if err != nil {
+		return nil, err
+	}
+	return []*watchdog.Campus{campus}, nil
+}
+
+// singleCampus returns the campus given in the `campus` parameter, which can be left empty when a single campus is served
+func singleCampus(params map[string]any) (*watchdog.Campus, error) {
+	name, _ := params["campus"].(string)
+	return watchdog.GetCampus(name)
+}
+
+// campusHeader separates the parts of a response that belong to each campus
+func campusHeader(campus *watchdog.Campus) string {
+	if campus.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("── %s ──\n", campus.Name)
+}
+
+// campusLocation returns the timezone of a campus, records written before campuses had names use the first one
+func campusLocation(name string) *time.Location {
+	if campus, err := watchdog.GetCampus(name); err == nil {
+		return campus.Location
+	}
+	return watchdog.CampusLocation()
+}
+
+func formatHistory(records []watchdog.AttendanceRecord) string {
+	if len(records) == 0 {
+		return "No attendance recorded for this filter"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d attendance records\n", len(records)))
+	for _, record := range records {
+		loc := campusLocation(record.Campus)
+		first, last := "--:--:--", "--:--:--"
+		if !record.FirstAccess.IsZero() {
+			first = record.FirstAccess.In(loc).Format("15:04:05")
+		}
+		if !record.LastAccess.IsZero() {
+			last = record.LastAccess.In(loc).Format("15:04:05")
+		}
+		posted := "not posted"
+		if record.PostedToChronos {
+			posted = "posted"
+		}
+		msg := record.Status
+		if record.PostError != "" {
+			msg = record.PostError
+		}
+		if ranges := record.CreditedRanges; len(ranges) > 0 && (!ranges[0].Begin.Equal(record.FirstAccess) || !ranges[len(ranges)-1].End.Equal(record.LastAccess)) {
+			var credited []string
+			for _, segment := range ranges {
+				credited = append(credited, fmt.Sprintf("%s-%s", segment.Begin.In(loc).Format("15:04:05"), segment.End.In(loc).Format("15:04:05")))
+			}
+			msg = fmt.Sprintf("%s ┆ posted %s", msg, strings.Join(credited, ", "))
+		}
+		if record.Campus != "" {
+			out.WriteString(record.Campus + " ")
+		}
+		out.WriteString(fmt.Sprintf("%s [%s-%s] %-8s (%s): %s -> %s %s (credited %s) ┆ %s ┆ %s\n",
+			record.Day, record.PeriodStart, record.PeriodEnd, record.Login42, record.ID42,
+			first, last, record.Duration.Round(time.Second), record.Credited.Round(time.Second), posted, msg))
+	}
+	return out.String()
+}
+
+func formatOutbox(entries []watchdog.OutboxEntry) string {
+	if len(entries) == 0 {
+		return "Outbox is empty"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d pending attendances\n", len(entries)))
+	for _, entry := range entries {
+		out.WriteString(fmt.Sprintf("#%-4d %-8s %s -> %s ┆ %d attempts ┆ next try %s ┆ %s\n",
+			entry.ID, entry.Login42, entry.Attendance.Begin_at, entry.Attendance.End_at,
+			entry.Attempts, entry.NextRetry.In(campusLocation(entry.Campus)).Format("02/01 15:04:05"), entry.LastError))
+	}
+	return out.String()
+}
+
+func formatSchedule(jobs []watchdog.ScheduledJob) string {
+	if len(jobs) == 0 {
+		return "No scheduled job"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d scheduled jobs\n", len(jobs)))
+	for _, job := range jobs {
+		out.WriteString(job.String() + "\n")
+	}
+	return out.String()
 }
 
-// Middleware function to verify the webhook signature
-func verifySignatureMiddleware(next http.Handler) http.Handler {
+func formatCalendar(closures []watchdog.Closure) string {
+	if len(closures) == 0 {
+		return "No closure day"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d closure days\n", len(closures)))
+	for _, closure := range closures {
+		out.WriteString(fmt.Sprintf("%s ┆ %-7s ┆ %s\n", closure.Date, closure.Source, closure.Reason))
+	}
+	return out.String()
+}
+
+func formatWatchtimeOverrides(overrides []watchdog.WatchtimeOverride) string {
+	if len(overrides) == 0 {
+		return "No watchtime override"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%d watchtime overrides\n", len(overrides)))
+	for _, override := range overrides {
+		out.WriteString(fmt.Sprintf("%s ┆ %-7s ┆ %s\n", override.Date, override.Source, override))
+	}
+	return out.String()
+}
+
+func formatNotifySummary(summary watchdog.NotifySummary) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Notified %d apprentices, %d failed, %d skipped (badged in and out)\n", len(summary.Notified), len(summary.Failed), summary.Skipped))
+	for _, login := range summary.Notified {
+		out.WriteString(fmt.Sprintf("✅ %s\n", login))
+	}
+	for login, err := range summary.Failed {
+		out.WriteString(fmt.Sprintf("❌ %s: %s\n", login, err))
+	}
+	return out.String()
+}
+
+// Middleware function to verify the webhook signature, with the secret of the campus the webhook is for
+func verifySignatureMiddleware(campus *watchdog.Campus, next http.Handler) http.Handler {
+	secrets := newWebhookSecrets(campus.Webhook)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			watchdog.Log(fmt.Sprintf("Middleware: Method not allowed: %s", r.Method))
@@ -158,39 +560,96 @@ func verifySignatureMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		receivedSigHex := r.Header.Get("x-webhook-signature")
-		if receivedSigHex == "" {
-			watchdog.Log("Middleware: Missing x-webhook-signature header")
-			http.Error(w, "Missing signature header", http.StatusUnauthorized)
-			return
-		}
-
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
 			watchdog.Log(fmt.Sprintf("Middleware: Error reading request body: %v", err))
 			http.Error(w, "Error reading request body", http.StatusInternalServerError)
 			return
 		}
+		receivedAt := time.Now()
 
 		// Restore the body so the next handler can read it.
 		r.Body.Close()
 		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
-		mac := hmac.New(sha512.New, []byte(webhookSecretKey))
-		mac.Write(bodyBytes)
-		expectedSigBytes := mac.Sum(nil)
-		calculatedSigHex := hex.EncodeToString(expectedSigBytes)
+		receivedSigHex := r.Header.Get("x-webhook-signature")
+		if receivedSigHex == "" {
+			journalWebhook(bodyBytes, SIGNATURE_MISSING, r.RemoteAddr, campus.Name)
+			watchdog.Log("Middleware: Missing x-webhook-signature header")
+			http.Error(w, "Missing signature header", http.StatusUnauthorized)
+			return
+		}
 
-		if !hmac.Equal([]byte(calculatedSigHex), []byte(receivedSigHex)) {
+		if !secrets.verify(bodyBytes, receivedSigHex) {
+			journalWebhook(bodyBytes, SIGNATURE_INVALID, r.RemoteAddr, campus.Name)
 			watchdog.Log("Middleware: Invalid signature. Request rejected")
 			http.Error(w, "Invalid signature", http.StatusForbidden)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		var payload CAPayload
+		if err = json.Unmarshal(bodyBytes, &payload); err != nil {
+			journalWebhook(bodyBytes, SIGNATURE_MALFORMED, r.RemoteAddr, campus.Name)
+			watchdog.Log(fmt.Sprintf("Middleware: Error unmarshalling webhook JSON: %v. Request rejected", err))
+			http.Error(w, "Invalid payload format", http.StatusBadRequest)
+			return
+		}
+		// A valid signature can be captured and sent again: old events and already seen signatures are refused.
+		// The event datetime is the one checked, the top-level one only tells when the box sent the payload.
+		eventDateTime := payload.Data.DateTime
+		if eventDateTime == "" {
+			eventDateTime = payload.DateTime
+		}
+		if err = checkEventFreshness(eventDateTime, campus.Location, receivedAt); err != nil {
+			journalWebhook(bodyBytes, SIGNATURE_STALE, r.RemoteAddr, campus.Name)
+			watchdog.Log(fmt.Sprintf("Middleware: Stale payload, %s. Request rejected", err.Error()))
+			http.Error(w, "Payload datetime outside tolerance window", http.StatusForbidden)
+			return
+		}
+		if !markSignatureSeen(receivedSigHex, receivedAt) {
+			journalWebhook(bodyBytes, SIGNATURE_REPLAYED, r.RemoteAddr, campus.Name)
+			watchdog.Log("Middleware: Signature already received. Request rejected")
+			http.Error(w, "Payload already received", http.StatusConflict)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// The event wasn't queued and access control sends it again with the same signature, it must be accepted then.
+		// Only the delivery that was queued is journaled as valid, so replay applies the event once.
+		if recorder.statusCode == http.StatusServiceUnavailable {
+			forgetSignature(receivedSigHex)
+			journalWebhook(bodyBytes, SIGNATURE_UNQUEUED, r.RemoteAddr, campus.Name)
+			return
+		}
+		journalWebhook(bodyBytes, SIGNATURE_VALID, r.RemoteAddr, campus.Name)
 	})
 }
 
-func accessControlEndpoint(w http.ResponseWriter, r *http.Request) {
+// statusRecorder keeps the status code answered by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (recorder *statusRecorder) WriteHeader(statusCode int) {
+	recorder.statusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+// parseEventTime reads the date of an event, sent by the access control box on campus time
+func parseEventTime(dateTime string, loc *time.Location) (time.Time, error) {
+	layout := "2006-01-02 15:04:05"
+	return time.ParseInLocation(layout, dateTime, loc)
+}
+
+// accessControlEndpoint returns the handler of the webhooks sent by the access control box of a campus
+func accessControlEndpoint(campus *watchdog.Campus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handleAccessControlEvent(campus, w, r)
+	}
+}
+
+func handleAccessControlEvent(campus *watchdog.Campus, w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("Handler: Error reading restored request body: %v", err)
@@ -220,15 +679,28 @@ func accessControlEndpoint(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Webhook received with empty user")
 		return
 	}
-	layout := "2006-01-02 15:04:05"
-	loc, _ := time.LoadLocation("Europe/Paris")
-	eventTime, err := time.ParseInLocation(layout, payload.Data.DateTime, loc)
+	eventTime, err := parseEventTime(payload.Data.DateTime, campus.Location)
 	if err != nil {
 		log.Printf("Handler: Error parsing event time '%s': %v", payload.Data.DateTime, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Webhook couldn't parse event time")
+		return
+	}
+	err = watchdog.EnqueueEvent(watchdog.AccessEvent{
+		Campus:     campus,
+		UserID:     *payload.Data.User,
+		UserName:   payload.Data.Event.UserName,
+		Time:       eventTime,
+		DoorName:   payload.Data.Event.DoorName,
+		DeviceName: payload.Data.Event.DeviceName,
+	})
+	if err != nil {
+		log.Printf("Handler: Couldn't queue event of user %d: %v", *payload.Data.User, err)
+		// Access control retries the delivery later, the event isn't lost
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, fmt.Sprintf("Webhook not processed: %s", err.Error()), http.StatusServiceUnavailable)
+		return
 	}
-	go watchdog.UpdateUserAccess(*payload.Data.User, payload.Data.Event.UserName, eventTime, payload.Data.Event.DoorName)
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Webhook received and queued to process")
 }
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadCalendar adds the closures of the calendar file to the ones of the config.
+// Times of the calendar file are read on campus time, location.
+func loadCalendar(calendar *ConfigCalendar, location *time.Location, name string) error {
+	if calendar.File == "" {
+		return nil
+	}
+	closures, err := loadCalendarFile(calendar.File, location)
+	if err != nil {
+		return fmt.Errorf("%s: couldn't load calendar: %w", name, err)
+	}
+	calendar.Closures = append(slices.Clone(calendar.Closures), closures...)
+	return nil
+}
+
+// loadCalendarFile reads closure days from a YAML list of closures or an ICS calendar
+func loadCalendarFile(path string, location *time.Location) ([]ConfigClosure, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics":
+		return loadICSCalendar(path, location)
+	case ".yml", ".yaml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var closures []ConfigClosure
+		if err = yaml.Unmarshal(data, &closures); err != nil {
+			return nil, err
+		}
+		return closures, nil
+	}
+	return nil, fmt.Errorf("unsupported calendar file %s (expected .ics, .yml or .yaml)", path)
+}
+
+// parseICSDate reads a DTSTART/DTEND value and its parameters, on campus time (location).
+// A date (20261225) is a whole day. A date-time is UTC (20261225T000000Z), in its TZID (DTSTART;TZID=Europe/Paris:20261225T000000),
+// or on campus time without any.
+func parseICSDate(value string, params []string, location *time.Location) (time.Time, error) {
+	if len(value) == 8 {
+		date, err := time.ParseInLocation("20060102", value, location)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid ICS date `%s`", value)
+		}
+		return date, nil
+	}
+	valueLocation := location
+	for _, param := range params {
+		if tzid, found := strings.CutPrefix(param, "TZID="); found {
+			var err error
+			valueLocation, err = time.LoadLocation(strings.Trim(tzid, `"`))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("unknown ICS TZID `%s`", tzid)
+			}
+		}
+	}
+	if utc, found := strings.CutSuffix(value, "Z"); found {
+		value, valueLocation = utc, time.UTC
+	}
+	date, err := time.ParseInLocation("20060102T150405", value, valueLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ICS date `%s`", value)
+	}
+	return date.In(location), nil
+}
+
+// startOfDay returns the midnight of the day of a time, on its own timezone
+func startOfDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
+
+// loadICSCalendar turns every VEVENT into a closure of the days it covers on campus time. As in ICS, DTEND is exclusive.
+// Recurring events aren't expanded: they are refused, so no closure is silently missed.
+func loadICSCalendar(path string, location *time.Location) ([]ConfigClosure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var closures []ConfigClosure
+	var start, end time.Time
+	var summary string
+	inEvent := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		// Parameters like DTSTART;VALUE=DATE or DTSTART;TZID=Europe/Paris
+		params := strings.Split(name, ";")
+		name = params[0]
+		switch name {
+		case "BEGIN":
+			if value == "VEVENT" {
+				inEvent = true
+				start, end, summary = time.Time{}, time.Time{}, ""
+			}
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			date, err := parseICSDate(value, params[1:], location)
+			if err != nil {
+				return nil, err
+			}
+			if name == "DTSTART" {
+				start = date
+			} else {
+				end = date
+			}
+		case "RRULE", "RDATE":
+			if inEvent {
+				return nil, fmt.Errorf("recurring ICS events (%s) are not supported, list each closure instead", name)
+			}
+		case "SUMMARY":
+			summary = value
+		case "END":
+			if value != "VEVENT" || !inEvent {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				continue
+			}
+			first := startOfDay(start)
+			last := first
+			if !end.IsZero() {
+				// The day of the last instant of the event
+				last = startOfDay(end.Add(-time.Nanosecond))
+			}
+			closure := ConfigClosure{Date: first.Format("2006-01-02"), Reason: summary}
+			if last.After(first) {
+				closure.End = last.Format("2006-01-02")
+			}
+			closures = append(closures, closure)
+		}
+	}
+	return closures, scanner.Err()
+}
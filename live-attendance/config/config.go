@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,6 +14,15 @@ const AccessControl string = "access-control"
 const FTv2 string = "42-v2"
 const FTAttendance string = "42-attendance"
 
+const defaultAttendanceSource string = "access-control"
+
+// Values of 42Attendance.postStrategy
+const (
+	PostStrategySegments string = "segments" // One attendance per presence segment, the default
+	PostStrategySpan     string = "span"     // One attendance per watch period, from first to last badge usage
+)
+const defaultWebhookPath string = "/webhook/access-control"
+
 var ConfigData ConfigFile
 
 type ConfigWatchtime struct {
@@ -20,6 +33,13 @@ type ConfigWatchtime struct {
 	Friday    [][]string `yaml:"friday"`
 	Saturday  [][]string `yaml:"saturday"`
 	Sunday    [][]string `yaml:"sunday"`
+	// Periods of a given day (YYYY-MM-DD), replacing the weekday ones. An empty list means no period that day.
+	Overrides map[string][][]string `yaml:"overrides"`
+}
+
+type ConfigWatchtimeBounds struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
 }
 
 type ConfigAccessControl struct {
@@ -29,6 +49,36 @@ type ConfigAccessControl struct {
 	Password string `yaml:"password"`
 }
 
+type ConfigWebhook struct {
+	Path       string   `yaml:"path"`
+	Secret     string   `yaml:"secret"`
+	Secrets    []string `yaml:"secrets"`    // Every secret accepted, several while the access control box is rotated
+	SecretFile string   `yaml:"secretFile"` // One secret per line, read again when it changes
+}
+
+// Secrets accepted on every campus webhook, and replay protection settings
+type ConfigWebhookSecurity struct {
+	Secrets      []string `yaml:"secrets"`
+	SecretFile   string   `yaml:"secretFile"`
+	Tolerance    string   `yaml:"tolerance"`    // Max gap between the payload datetime and its reception, "0s" to disable
+	ReplayWindow string   `yaml:"replayWindow"` // How long a signature is remembered to reject it when sent again
+}
+
+// One site served by the server. In the campuses list, an empty AccessControl, watchtime or recipients
+// falls back on the top level one.
+type ConfigCampus struct {
+	Name             string              `yaml:"name"` // Required in the campuses list, used in commands and storage paths
+	ID               int                 `yaml:"id"`
+	Timezone         string              `yaml:"timezone"`         // IANA name, like Europe/Paris
+	AttendanceSource string              `yaml:"attendanceSource"` // Source of the attendances posted to Chronos
+	AccessControl    ConfigAccessControl `yaml:"AccessControl"`
+	Webhook          ConfigWebhook       `yaml:"webhook"`
+	Watchtime        ConfigWatchtime     `yaml:"watchtime"`
+	Calendar         ConfigCalendar      `yaml:"calendar"` // Closure days, the top level calendar when empty
+	Recipients       []string            `yaml:"recipients"`
+	Location         *time.Location      `yaml:"-"` // Loaded from Timezone
+}
+
 type ConfigAPIV2 struct {
 	TokenUrl           string   `yaml:"tokenUrl"`
 	Endpoint           string   `yaml:"endpoint"`
@@ -36,19 +86,21 @@ type ConfigAPIV2 struct {
 	Uid                string   `yaml:"uid"`
 	Secret             string   `yaml:"secret"`
 	Scope              string   `yaml:"scope"`
-	CampusID           string   `yaml:"campusId"`
+	CampusID           string   `yaml:"campusId"` // Deprecated, use campus.id
 	ApprenticeProjects []string `yaml:"apprenticeProjects"`
+	LoadRoster         bool     `yaml:"loadRoster"`
 }
 
 type ConfigAttendance42 struct {
-	AutoPost bool   `yaml:"autoPost"`
-	TokenUrl string `yaml:"tokenUrl"`
-	Endpoint string `yaml:"endpoint"`
-	TestPath string `yaml:"testpath"`
-	Uid      string `yaml:"uid"`
-	Secret   string `yaml:"secret"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	AutoPost     bool   `yaml:"autoPost"`
+	PostStrategy string `yaml:"postStrategy"`
+	TokenUrl     string `yaml:"tokenUrl"`
+	Endpoint     string `yaml:"endpoint"`
+	TestPath     string `yaml:"testpath"`
+	Uid          string `yaml:"uid"`
+	Secret       string `yaml:"secret"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
 }
 
 type ConfigMailer struct {
@@ -64,12 +116,127 @@ type ConfigMailer struct {
 	Recipients []string `yaml:"recipients"`
 }
 
+const (
+	RoleRead     string = "read"
+	RoleOperator string = "operator"
+	RoleAdmin    string = "admin"
+)
+
+// Client allowed to send commands, with the role deciding which ones
+type ConfigCommandToken struct {
+	Name  string `yaml:"name"` // Shown in logs
+	Role  string `yaml:"role"` // read, operator or admin
+	Token string `yaml:"token"`
+}
+
+type ConfigCommands struct {
+	Tokens []ConfigCommandToken `yaml:"tokens"`
+}
+
+// Append-only log of the commands changing the server state
+type ConfigAudit struct {
+	Path string `yaml:"path"`
+}
+
+type ConfigStorage struct {
+	Directory     string `yaml:"directory"`
+	SnapshotEvery int    `yaml:"snapshotEvery"`
+}
+
+type ConfigWebhookJournal struct {
+	Directory string `yaml:"directory"`
+	MaxFiles  int    `yaml:"maxFiles"`
+}
+
+type ConfigOutbox struct {
+	RetryDelay string `yaml:"retryDelay"`
+	MaxDelay   string `yaml:"maxDelay"`
+}
+
+type ConfigLedger struct {
+	Path          string `yaml:"path"`
+	CheckChronos  bool   `yaml:"checkChronos"`
+	RetentionDays int    `yaml:"retentionDays"` // Posted attendances older than this are forgotten, 0 keeps them all
+}
+
+type ConfigDoors struct {
+	Entry    []string `yaml:"entry"`
+	Exit     []string `yaml:"exit"`
+	Internal []string `yaml:"internal"`
+}
+
+type ConfigRules struct {
+	BreakAfter    string `yaml:"breakAfter"`
+	BreakDuration string `yaml:"breakDuration"`
+	MaxDaily      string `yaml:"maxDaily"`
+	Rounding      string `yaml:"rounding"`
+	ClampToPeriod bool   `yaml:"clampToPeriod"`
+}
+
+type ConfigClosure struct {
+	Date   string `yaml:"date" json:"date"`                   // YYYY-MM-DD
+	End    string `yaml:"end,omitempty" json:"end,omitempty"` // Last closed day (inclusive), for ranges
+	Reason string `yaml:"reason" json:"reason"`
+}
+
+type ConfigCalendar struct {
+	File     string          `yaml:"file"` // .ics or .yml list of closures, merged with the ones below
+	Closures []ConfigClosure `yaml:"closures"`
+}
+
+type ConfigDateRange struct {
+	From string `yaml:"from"` // YYYY-MM-DD, inclusive
+	To   string `yaml:"to"`   // YYYY-MM-DD, inclusive. Empty for a single day
+}
+
+// School/company alternation of a cohort. When school days or ranges are set, other days are company days.
+type ConfigRhythm struct {
+	Name       string            `yaml:"name"`
+	Logins     []string          `yaml:"logins"`
+	SchoolDays []string          `yaml:"schoolDays"` // Weekly pattern
+	School     []ConfigDateRange `yaml:"school"`     // Explicit school ranges
+	Company    []ConfigDateRange `yaml:"company"`    // Company ranges, win over school days and ranges
+}
+
+type ConfigRhythms struct {
+	File    string         `yaml:"file"` // CSV of per-apprentice rhythms, they win over cohorts
+	Cohorts []ConfigRhythm `yaml:"cohorts"`
+}
+
+type ConfigQueue struct {
+	Workers  int `yaml:"workers"`
+	Capacity int `yaml:"capacity"`
+}
+
+type ConfigJob struct {
+	Time   string   `yaml:"time" json:"time"`
+	Days   []string `yaml:"days" json:"days"`
+	Action string   `yaml:"action" json:"action"`
+	Campus string   `yaml:"campus,omitempty" json:"campus,omitempty"` // Empty to run on every campus
+}
+
 type ConfigFile struct {
-	AccessControl ConfigAccessControl `yaml:"AccessControl"`
-	ApiV2         ConfigAPIV2         `yaml:"42apiV2"`
-	Attendance42  ConfigAttendance42  `yaml:"42Attendance"`
-	Mailer        ConfigMailer        `yaml:"mailer"`
-	Watchtime     ConfigWatchtime     `yaml:"watchtime"`
+	Campus        ConfigCampus          `yaml:"campus"`   // Single campus setup
+	Campuses      []ConfigCampus        `yaml:"campuses"` // Several campuses served by one server, replaces campus
+	AccessControl ConfigAccessControl   `yaml:"AccessControl"`
+	ApiV2         ConfigAPIV2           `yaml:"42apiV2"`
+	Attendance42  ConfigAttendance42    `yaml:"42Attendance"`
+	Mailer        ConfigMailer          `yaml:"mailer"`
+	Watchtime     ConfigWatchtime       `yaml:"watchtime"`
+	Bounds        ConfigWatchtimeBounds `yaml:"watchtimeBounds"`
+	Storage       ConfigStorage         `yaml:"storage"`
+	Webhook       ConfigWebhookSecurity `yaml:"webhook"`
+	Commands      ConfigCommands        `yaml:"commands"`
+	Audit         ConfigAudit           `yaml:"audit"`
+	Journal       ConfigWebhookJournal  `yaml:"webhookJournal"`
+	Outbox        ConfigOutbox          `yaml:"outbox"`
+	Ledger        ConfigLedger          `yaml:"ledger"`
+	Schedule      []ConfigJob           `yaml:"schedule"`
+	Queue         ConfigQueue           `yaml:"queue"`
+	Doors         ConfigDoors           `yaml:"doors"`
+	Rules         ConfigRules           `yaml:"rules"`
+	Calendar      ConfigCalendar        `yaml:"calendar"`
+	Rhythms       ConfigRhythms         `yaml:"rhythms"`
 }
 
 func LoadConfig(path string) error {
@@ -84,5 +251,177 @@ func LoadConfig(path string) error {
 	if err != nil {
 		return err
 	}
+
+	if err = loadCampuses(); err != nil {
+		return err
+	}
+
+	if err = loadCommandTokens(); err != nil {
+		return err
+	}
+
+	if err = loadPostStrategy(); err != nil {
+		return err
+	}
+
+	if ConfigData.Rhythms.File != "" {
+		rhythms, err := loadRhythmsCSV(ConfigData.Rhythms.File)
+		if err != nil {
+			return fmt.Errorf("couldn't load rhythms: %w", err)
+		}
+		ConfigData.Rhythms.Cohorts = append(ConfigData.Rhythms.Cohorts, rhythms...)
+	}
+	return nil
+}
+
+// loadPostStrategy checks 42Attendance.postStrategy, posting presence segments when it isn't set
+func loadPostStrategy() error {
+	switch ConfigData.Attendance42.PostStrategy {
+	case "":
+		ConfigData.Attendance42.PostStrategy = PostStrategySegments
+	case PostStrategySegments, PostStrategySpan:
+	default:
+		return fmt.Errorf("invalid 42Attendance.postStrategy `%s` (%s or %s)", ConfigData.Attendance42.PostStrategy, PostStrategySegments, PostStrategySpan)
+	}
+	return nil
+}
+
+// loadCampuses checks the campuses list, or builds it from the single campus block and the top level settings
+func loadCampuses() error {
+	if len(ConfigData.Campuses) == 0 {
+		campus := ConfigData.Campus
+		campus.Name = ""
+		if err := loadCampus(&campus, ConfigData.ApiV2.CampusID, "campus"); err != nil {
+			return err
+		}
+		if campus.Webhook.Path == "" {
+			campus.Webhook.Path = defaultWebhookPath
+		}
+		campus.AccessControl = ConfigData.AccessControl
+		campus.Watchtime = ConfigData.Watchtime
+		campus.Calendar = ConfigData.Calendar
+		campus.Recipients = ConfigData.Mailer.Recipients
+		if err := loadWebhookSecrets(&campus, "campus"); err != nil {
+			return err
+		}
+		if err := loadCalendar(&campus.Calendar, campus.Location, "campus"); err != nil {
+			return err
+		}
+		ConfigData.Campuses = []ConfigCampus{campus}
+		ConfigData.Campus = campus
+		return nil
+	}
+
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	for i := range ConfigData.Campuses {
+		campus := &ConfigData.Campuses[i]
+		if campus.Name == "" {
+			return fmt.Errorf("campuses[%d].name is required", i)
+		}
+		if strings.ContainsAny(campus.Name, `/\ `) {
+			return fmt.Errorf("invalid campus name `%s` (no slash or space)", campus.Name)
+		}
+		if names[campus.Name] {
+			return fmt.Errorf("campus `%s` is defined twice", campus.Name)
+		}
+		names[campus.Name] = true
+		if err := loadCampus(campus, "", "campus "+campus.Name); err != nil {
+			return err
+		}
+		if campus.Webhook.Path == "" {
+			campus.Webhook.Path = defaultWebhookPath + "/" + campus.Name
+		}
+		if paths[campus.Webhook.Path] {
+			return fmt.Errorf("campus %s: webhook path %s is used by another campus", campus.Name, campus.Webhook.Path)
+		}
+		paths[campus.Webhook.Path] = true
+		if campus.AccessControl.Endpoint == "" {
+			campus.AccessControl = ConfigData.AccessControl
+		}
+		if campus.Watchtime.empty() {
+			campus.Watchtime = ConfigData.Watchtime
+		}
+		if campus.Calendar.File == "" && len(campus.Calendar.Closures) == 0 {
+			campus.Calendar = ConfigData.Calendar
+		}
+		if len(campus.Recipients) == 0 {
+			campus.Recipients = ConfigData.Mailer.Recipients
+		}
+		if err := loadWebhookSecrets(campus, "campus "+campus.Name); err != nil {
+			return err
+		}
+		if err := loadCalendar(&campus.Calendar, campus.Location, "campus "+campus.Name); err != nil {
+			return err
+		}
+	}
+	// Keeps single campus readers working, the first campus is the reference one
+	ConfigData.Campus = ConfigData.Campuses[0]
+	return nil
+}
+
+// loadCommandTokens checks the tokens allowed on /commands. Without any, nobody could manage the server.
+func loadCommandTokens() error {
+	if len(ConfigData.Commands.Tokens) == 0 {
+		return fmt.Errorf("commands.tokens: at least one token is required")
+	}
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for i, token := range ConfigData.Commands.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("commands.tokens[%d].name is required", i)
+		}
+		if names[token.Name] {
+			return fmt.Errorf("command token `%s` is defined twice", token.Name)
+		}
+		names[token.Name] = true
+		switch token.Role {
+		case RoleRead, RoleOperator, RoleAdmin:
+		default:
+			return fmt.Errorf("command token %s: invalid role `%s` (expected %s, %s or %s)", token.Name, token.Role, RoleRead, RoleOperator, RoleAdmin)
+		}
+		if token.Token == "" {
+			return fmt.Errorf("command token %s: token is required", token.Name)
+		}
+		if tokens[token.Token] {
+			return fmt.Errorf("command token %s: token is already used by another client", token.Name)
+		}
+		tokens[token.Token] = true
+	}
+	return nil
+}
+
+func (watchtime ConfigWatchtime) empty() bool {
+	for _, day := range [][][]string{watchtime.Monday, watchtime.Tuesday, watchtime.Wednesday, watchtime.Thursday, watchtime.Friday, watchtime.Saturday, watchtime.Sunday} {
+		if len(day) > 0 {
+			return false
+		}
+	}
+	return len(watchtime.Overrides) == 0
+}
+
+// loadCampus checks a campus block and loads its timezone. legacyID is the old 42apiV2.campusId.
+func loadCampus(campus *ConfigCampus, legacyID string, name string) error {
+	if campus.ID == 0 && legacyID != "" {
+		id, err := strconv.Atoi(legacyID)
+		if err != nil {
+			return fmt.Errorf("invalid 42apiV2.campusId `%s`", legacyID)
+		}
+		campus.ID = id
+	}
+	if campus.ID <= 0 {
+		return fmt.Errorf("%s: id is required", name)
+	}
+	if campus.Timezone == "" {
+		return fmt.Errorf("%s: timezone is required (IANA name, like Europe/Paris)", name)
+	}
+	location, err := time.LoadLocation(campus.Timezone)
+	if err != nil {
+		return fmt.Errorf("%s: invalid timezone `%s`: %w", name, campus.Timezone, err)
+	}
+	campus.Location = location
+	if campus.AttendanceSource == "" {
+		campus.AttendanceSource = defaultAttendanceSource
+	}
 	return nil
 }
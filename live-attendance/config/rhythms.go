@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// loadRhythmsCSV reads per-apprentice rhythms, one row per weekly pattern or date range:
+//
+//	login,kind,days,from,to
+//	jdoe,school,monday|tuesday,,
+//	jdoe,company,,2026-10-05,2026-10-16
+//
+// kind is school (default) or company. Rows of the same login are merged in one rhythm.
+func loadRhythmsCSV(path string) ([]ConfigRhythm, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var rhythms []ConfigRhythm
+	byLogin := map[string]int{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for len(record) < 5 {
+			record = append(record, "")
+		}
+		login := strings.ToLower(strings.TrimSpace(record[0]))
+		if login == "" || (line == 1 && login == "login") {
+			continue
+		}
+		index, ok := byLogin[login]
+		if !ok {
+			index = len(rhythms)
+			byLogin[login] = index
+			rhythms = append(rhythms, ConfigRhythm{Name: login, Logins: []string{login}})
+		}
+
+		kind := strings.ToLower(strings.TrimSpace(record[1]))
+		days := strings.TrimSpace(record[2])
+		dates := ConfigDateRange{From: strings.TrimSpace(record[3]), To: strings.TrimSpace(record[4])}
+		switch kind {
+		case "", "school":
+			if days != "" {
+				rhythms[index].SchoolDays = append(rhythms[index].SchoolDays, strings.Split(days, "|")...)
+			}
+			if dates.From != "" {
+				rhythms[index].School = append(rhythms[index].School, dates)
+			}
+		case "company":
+			if days != "" {
+				return nil, fmt.Errorf("line %d: company rows take dates, not days", line)
+			}
+			rhythms[index].Company = append(rhythms[index].Company, dates)
+		default:
+			return nil, fmt.Errorf("line %d: unknown kind `%s` (expected school or company)", line, kind)
+		}
+	}
+	return rhythms, nil
+}
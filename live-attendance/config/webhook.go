@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadWebhookSecrets merges the secrets of a campus webhook, falling back on the top level ones.
+// A webhook without any secret is refused, as anyone could post badge events.
+func loadWebhookSecrets(campus *ConfigCampus, name string) error {
+	if campus.Webhook.Secret != "" {
+		campus.Webhook.Secrets = append([]string{campus.Webhook.Secret}, campus.Webhook.Secrets...)
+		campus.Webhook.Secret = ""
+	}
+	if len(campus.Webhook.Secrets) == 0 && campus.Webhook.SecretFile == "" {
+		campus.Webhook.Secrets = ConfigData.Webhook.Secrets
+		campus.Webhook.SecretFile = ConfigData.Webhook.SecretFile
+	}
+	if campus.Webhook.SecretFile != "" {
+		if _, err := ReadSecretFile(campus.Webhook.SecretFile); err != nil {
+			return fmt.Errorf("%s: couldn't read webhook secret file: %w", name, err)
+		}
+	} else if len(campus.Webhook.Secrets) == 0 {
+		return fmt.Errorf("%s: a webhook secret is required (webhook.secrets or webhook.secretFile)", name)
+	}
+	for _, secret := range campus.Webhook.Secrets {
+		if strings.TrimSpace(secret) == "" {
+			return fmt.Errorf("%s: webhook secrets can't be empty", name)
+		}
+	}
+	return nil
+}
+
+// ReadSecretFile returns the secrets of a file, one per line. Empty lines and lines starting with # are ignored.
+func ReadSecretFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var secrets []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		secrets = append(secrets, line)
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secret in %s", path)
+	}
+	return secrets, nil
+}
@@ -3,12 +3,18 @@ module watchdog
 go 1.24.4
 
 require (
+	github.com/TheKrainBow/42-watchdog/ledger v0.0.0
 	github.com/TheKrainBow/go-api v1.0.5
+	go.etcd.io/bbolt v1.4.3
 	gopkg.in/yaml.v2 v2.4.0
 )
 
+require golang.org/x/sys v0.29.0 // indirect
+
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/cobra v1.9.1 // direct
 	github.com/spf13/pflag v1.0.6 // indirect
 )
+
+replace github.com/TheKrainBow/42-watchdog/ledger => ../ledger
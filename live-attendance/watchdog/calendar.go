@@ -0,0 +1,175 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"watchdog/config"
+)
+
+const calendarFile = "calendar.json"
+
+const (
+	CLOSURE_CONFIG  string = "config"
+	CLOSURE_RUNTIME string = "runtime"
+)
+
+// A day the campus is closed: nothing is listened to, posted or reported
+type Closure struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+	Source string `json:"source"` // config (calendar file or config) or runtime (added with the client)
+}
+
+// expandClosure returns one closure per day of a closure definition
+func expandClosure(definition config.ConfigClosure, source string) ([]Closure, error) {
+	first, err := time.Parse("2006-01-02", definition.Date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid closure date `%s` (expected YYYY-MM-DD)", definition.Date)
+	}
+	last := first
+	if definition.End != "" {
+		last, err = time.Parse("2006-01-02", definition.End)
+		if err != nil || last.Before(first) {
+			return nil, fmt.Errorf("invalid closure end `%s`", definition.End)
+		}
+	}
+	var days []Closure
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, Closure{Date: day.Format("2006-01-02"), Reason: definition.Reason, Source: source})
+	}
+	return days, nil
+}
+
+// initCalendar loads the closures of the campus calendar and the ones added at runtime.
+// Closures saved before campuses had their own calendar, in the storage directory itself, apply to every campus.
+func (campus *Campus) initCalendar() error {
+	loaded := map[string]Closure{}
+	for _, definition := range campus.Calendar.Closures {
+		days, err := expandClosure(definition, CLOSURE_CONFIG)
+		if err != nil {
+			return err
+		}
+		for _, closure := range days {
+			loaded[closure.Date] = closure
+		}
+	}
+
+	if dir := campus.storageDirectory(); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, calendarFile))
+		if errors.Is(err, os.ErrNotExist) && dir != config.ConfigData.Storage.Directory {
+			data, err = os.ReadFile(filepath.Join(config.ConfigData.Storage.Directory, calendarFile))
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("couldn't read saved calendar: %w", err)
+		}
+		if err == nil {
+			var saved []Closure
+			if err = json.Unmarshal(data, &saved); err != nil {
+				return fmt.Errorf("couldn't read saved calendar: %w", err)
+			}
+			for _, closure := range saved {
+				if _, exists := loaded[closure.Date]; !exists {
+					loaded[closure.Date] = closure
+				}
+			}
+		}
+	}
+
+	campus.calendarMutex.Lock()
+	campus.closures = loaded
+	campus.calendarMutex.Unlock()
+	campus.Log(fmt.Sprintf("[CALENDAR] 📆 Loaded %d closure days", len(loaded)))
+	return nil
+}
+
+// saveCalendar keeps runtime closures across restarts. calendarMutex must be held.
+func (campus *Campus) saveCalendar() {
+	dir := campus.storageDirectory()
+	if dir == "" || storageReadOnly {
+		return
+	}
+	saved := []Closure{}
+	for _, closure := range campus.closures {
+		if closure.Source == CLOSURE_RUNTIME {
+			saved = append(saved, closure)
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		campus.Log(fmt.Sprintf("[CALENDAR] ERROR: couldn't encode calendar: %s", err.Error()))
+		return
+	}
+	if err = os.WriteFile(filepath.Join(dir, calendarFile), data, 0644); err != nil {
+		campus.Log(fmt.Sprintf("[CALENDAR] ERROR: couldn't save calendar: %s", err.Error()))
+	}
+}
+
+// closureOn tells if the campus is closed on the day of the given time, which must be on campus time
+func (campus *Campus) closureOn(day time.Time) (Closure, bool) {
+	campus.calendarMutex.Lock()
+	defer campus.calendarMutex.Unlock()
+	closure, closed := campus.closures[day.Format("2006-01-02")]
+	return closure, closed
+}
+
+func (campus *Campus) isClosed(day time.Time) bool {
+	_, closed := campus.closureOn(day)
+	return closed
+}
+
+// ListClosures returns closure days, ordered by date
+func (campus *Campus) ListClosures() []Closure {
+	campus.calendarMutex.Lock()
+	defer campus.calendarMutex.Unlock()
+	list := make([]Closure, 0, len(campus.closures))
+	for _, closure := range campus.closures {
+		list = append(list, closure)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date < list[j].Date
+	})
+	return list
+}
+
+// AddClosure closes the campus on a day, or on every day of a range
+func (campus *Campus) AddClosure(definition config.ConfigClosure) ([]Closure, error) {
+	days, err := expandClosure(definition, CLOSURE_RUNTIME)
+	if err != nil {
+		return nil, err
+	}
+	campus.calendarMutex.Lock()
+	defer campus.calendarMutex.Unlock()
+	for _, closure := range days {
+		if _, exists := campus.closures[closure.Date]; exists {
+			return nil, fmt.Errorf("campus is already closed on %s", closure.Date)
+		}
+	}
+	for _, closure := range days {
+		campus.closures[closure.Date] = closure
+		campus.Log(fmt.Sprintf("[CALENDAR] ➕ Campus closed on %s (%s)", closure.Date, closure.Reason))
+	}
+	campus.saveCalendar()
+	return days, nil
+}
+
+// RemoveClosure reopens the campus on a day closed at runtime
+func (campus *Campus) RemoveClosure(date string) error {
+	campus.calendarMutex.Lock()
+	defer campus.calendarMutex.Unlock()
+	closure, exists := campus.closures[date]
+	if !exists {
+		return fmt.Errorf("campus is not closed on %s", date)
+	}
+	if closure.Source != CLOSURE_RUNTIME {
+		return fmt.Errorf("closure of %s comes from config, edit the calendar there", date)
+	}
+	delete(campus.closures, date)
+	campus.saveCalendar()
+	campus.Log(fmt.Sprintf("[CALENDAR] ➖ Campus reopened on %s", date))
+	return nil
+}
@@ -0,0 +1,183 @@
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"watchdog/config"
+)
+
+// Campus holds everything that belongs to one site: its users, its watch periods and its state store.
+// Lock order is timePeriodMutex → watchtimeMutex and timePeriodMutex → AllUsersMutex.
+type Campus struct {
+	config.ConfigCampus
+
+	AllUsers      map[int]User
+	AllUsersMutex sync.Mutex
+
+	// 42 user ID of every badge seen, temporary ones included. Its own mutex, so queuing an event never waits
+	// for a worker holding AllUsersMutex while it resolves a new user.
+	badgeOwners      map[int]int
+	badgeOwnersMutex sync.Mutex
+
+	watchtime                 map[time.Weekday][]TimePeriod
+	currentTimePeriod         *TimePeriod
+	timePeriodMutex           sync.Mutex
+	watchtimeSchedulerRunning bool
+	watchtimeSchedulerStop    chan struct{} // Closed to stop the watchtime scheduler
+	watchtimeSchedulerDone    chan struct{} // Closed by the watchtime scheduler once stopped
+
+	// Runtime overrides take precedence over the config ones, clearing them brings the config one back
+	configOverrides  map[string]WatchtimeOverride
+	runtimeOverrides map[string]WatchtimeOverride
+	watchtimeMutex   sync.RWMutex
+	watchtimeChanged chan struct{} // Wakes the watchtime scheduler up when periods change
+
+	closures      map[string]Closure // Closure days, keyed by date (YYYY-MM-DD)
+	calendarMutex sync.Mutex
+
+	acceptEvents      bool
+	acceptEventsMutex sync.Mutex
+
+	stateDirectory      string
+	stateJournal        *os.File
+	stateJournalEntries int
+	stateMutex          sync.Mutex
+}
+
+// Campuses served by this server, in config order
+var Campuses []*Campus
+
+func newCampus(definition config.ConfigCampus) *Campus {
+	return &Campus{
+		ConfigCampus:     definition,
+		AllUsers:         make(map[int]User),
+		badgeOwners:      map[int]int{},
+		watchtime:        make(map[time.Weekday][]TimePeriod),
+		configOverrides:  map[string]WatchtimeOverride{},
+		runtimeOverrides: map[string]WatchtimeOverride{},
+		watchtimeChanged: make(chan struct{}, 1),
+		closures:         map[string]Closure{},
+	}
+}
+
+func initCampuses() {
+	Campuses = nil
+	for _, definition := range config.ConfigData.Campuses {
+		Campuses = append(Campuses, newCampus(definition))
+	}
+}
+
+// GetCampus returns the campus with the given name. The name can be left empty when a single campus is served.
+func GetCampus(name string) (*Campus, error) {
+	if name == "" {
+		if len(Campuses) == 1 {
+			return Campuses[0], nil
+		}
+		return nil, fmt.Errorf("several campuses are served, pick one of %s", campusNames())
+	}
+	for _, campus := range Campuses {
+		if campus.Name == name {
+			return campus, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown campus `%s` (expected one of %s)", name, campusNames())
+}
+
+// campusByName returns the campus with the given name, or the first one for records written before campuses had names
+func campusByName(name string) *Campus {
+	for _, campus := range Campuses {
+		if campus.Name == name {
+			return campus
+		}
+	}
+	if len(Campuses) > 0 {
+		return Campuses[0]
+	}
+	return nil
+}
+
+func campusNames() string {
+	var names []string
+	for _, campus := range Campuses {
+		names = append(names, campus.Name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%v", names)
+}
+
+// Log prefixes messages with the campus name, when the server has named campuses
+func (campus *Campus) Log(msg string) {
+	if campus.Name == "" || msg == "" {
+		Log(msg)
+		return
+	}
+	Log(fmt.Sprintf("[%s] %s", campus.Name, msg))
+}
+
+// tag is added to report titles, so mails of different campuses can be told apart
+func (campus *Campus) tag() string {
+	if campus.Name == "" {
+		return ""
+	}
+	return " [" + campus.Name + "]"
+}
+
+// now returns the current time on campus, watch periods and days are all in its timezone
+func (campus *Campus) now() time.Time {
+	return time.Now().In(campus.Location)
+}
+
+// accessControlClient is the name of the API client of the campus access control box
+func (campus *Campus) accessControlClient() string {
+	if campus.Name == "" {
+		return config.AccessControl
+	}
+	return config.AccessControl + "-" + campus.Name
+}
+
+// storageDirectory is where the campus keeps its state. A single unnamed campus uses the storage directory itself.
+func (campus *Campus) storageDirectory() string {
+	dir := config.ConfigData.Storage.Directory
+	if dir == "" || campus.Name == "" {
+		return dir
+	}
+	return filepath.Join(dir, campus.Name)
+}
+
+// userKey returns the 42 user ID a badge belongs to, so every badge of a user is handled by the same event worker.
+// Badges never seen are resolved by their first event: until then, the badge itself is returned.
+func (campus *Campus) userKey(badge int) int {
+	campus.badgeOwnersMutex.Lock()
+	defer campus.badgeOwnersMutex.Unlock()
+	if id42, known := campus.badgeOwners[badge]; known {
+		return id42
+	}
+	return badge
+}
+
+// setBadgeOwner records the 42 user a badge belongs to
+func (campus *Campus) setBadgeOwner(badge int, user User) {
+	id42, err := strconv.Atoi(user.ID42)
+	if err != nil {
+		return
+	}
+	campus.badgeOwnersMutex.Lock()
+	campus.badgeOwners[badge] = id42
+	campus.badgeOwnersMutex.Unlock()
+}
+
+// SnapshotUsers returns a copy of the campus users, safe to read without holding AllUsersMutex
+func (campus *Campus) SnapshotUsers() map[int]User {
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+	users := make(map[int]User, len(campus.AllUsers))
+	for id, user := range campus.AllUsers {
+		users[id] = user
+	}
+	return users
+}
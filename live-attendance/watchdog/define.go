@@ -1,13 +1,9 @@
 package watchdog
 
 import (
-	"sync"
 	"time"
 )
 
-var AllUsers map[int]User
-var AllUsersMutex sync.Mutex
-
 const (
 	NO_BADGE       string = "User didn't badged yet"
 	BADGED_ONCE    string = "User badge only once"
@@ -18,20 +14,27 @@ const (
 	POSTED                 string = "Posted"
 	POST_ERROR             string = "Post returned an error"
 	POST_OFF               string = "AUTOPOST is off"
+	ALREADY_POSTED         string = "Already posted"
+	NOTHING_CREDITED       string = "Nothing to credit after attendance rules"
+	APPRENTICE_AT_COMPANY  string = "Apprentice is at company today"
+	POST_PENDING           string = "Will be posted at the end of the watch period"
 )
 
 type User struct {
-	ControlAccessID   int           `json:"control_access_id"`
-	ControlAccessName string        `json:"control_access_name"`
-	Login42           string        `json:"login_42"`
-	ID42              string        `json:"id_42"`
-	IsApprentice      bool          `json:"is_apprentice"`
-	FirstAccess       time.Time     `json:"first_access"`
-	LastAccess        time.Time     `json:"last_access"`
-	Duration          time.Duration `json:"duration"`
-	Profile           ProfileType
-	Error             error
-	Status            string
+	ControlAccessID   int               `json:"control_access_id"`
+	ControlAccessName string            `json:"control_access_name"`
+	Login42           string            `json:"login_42"`
+	ID42              string            `json:"id_42"`
+	IsApprentice      bool              `json:"is_apprentice"`
+	FirstAccess       time.Time         `json:"first_access"`
+	LastAccess        time.Time         `json:"last_access"`
+	Duration          time.Duration     `json:"duration"` // Time spent on site, see presenceSegments
+	Swipes            []Swipe           `json:"swipes,omitempty"`
+	Credited          time.Duration     `json:"credited"`                  // Duration after attendance rules, set when posting
+	CreditedRanges    []PresenceSegment `json:"credited_ranges,omitempty"` // Posted begin/end, FirstAccess/LastAccess stay the real ones
+	Profile           ProfileType       `json:"profile"`
+	Error             error             `json:"-"`
+	Status            string            `json:"status"`
 }
 
 type ProjectResponse struct {
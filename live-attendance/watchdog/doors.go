@@ -0,0 +1,137 @@
+package watchdog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+const (
+	DOOR_ENTRY    string = "entry"
+	DOOR_EXIT     string = "exit"
+	DOOR_INTERNAL string = "internal"
+)
+
+// One badge usage of a user during the running watch period
+type Swipe struct {
+	Time      time.Time `json:"time"`
+	Door      string    `json:"door"`
+	Direction string    `json:"direction"`
+}
+
+// Time range a user spent on site
+type PresenceSegment struct {
+	Begin time.Time `json:"begin"`
+	End   time.Time `json:"end"`
+}
+
+func (segment PresenceSegment) Duration() time.Duration {
+	return segment.End.Sub(segment.Begin)
+}
+
+// classifyDoor tells if a door lets people in, out, or is inside the campus.
+// Doors missing from config are internal, so a campus without door config keeps first -> last durations.
+func classifyDoor(doorName string, deviceName string) string {
+	doors := config.ConfigData.Doors
+	for _, name := range []string{doorName, deviceName} {
+		if name == "" {
+			continue
+		}
+		for _, entry := range doors.Entry {
+			if strings.EqualFold(entry, name) {
+				return DOOR_ENTRY
+			}
+		}
+		for _, exit := range doors.Exit {
+			if strings.EqualFold(exit, name) {
+				return DOOR_EXIT
+			}
+		}
+	}
+	return DOOR_INTERNAL
+}
+
+// addSwipe records a badge usage and recomputes the user's access times and on-site duration.
+// A swipe already recorded (same time and door, from a webhook delivered twice) is ignored and false is returned.
+func addSwipe(user *User, swipe Swipe) bool {
+	for _, known := range user.Swipes {
+		if known.Time.Equal(swipe.Time) && known.Door == swipe.Door && known.Direction == swipe.Direction {
+			return false
+		}
+	}
+	// Users restored from a state saved before swipes were kept only know their first and last access
+	if len(user.Swipes) == 0 && !user.FirstAccess.IsZero() {
+		user.Swipes = append(user.Swipes, Swipe{Time: user.FirstAccess, Direction: DOOR_INTERNAL})
+		if !user.LastAccess.Equal(user.FirstAccess) {
+			user.Swipes = append(user.Swipes, Swipe{Time: user.LastAccess, Direction: DOOR_INTERNAL})
+		}
+	}
+	user.Swipes = append(user.Swipes, swipe)
+	sort.SliceStable(user.Swipes, func(i, j int) bool {
+		return user.Swipes[i].Time.Before(user.Swipes[j].Time)
+	})
+
+	user.FirstAccess = user.Swipes[0].Time
+	user.LastAccess = user.Swipes[len(user.Swipes)-1].Time
+	user.Duration = 0
+	for _, segment := range presenceSegments(user.Swipes) {
+		user.Duration += segment.Duration()
+	}
+	return true
+}
+
+// presenceSegments rebuilds on-site ranges from ordered swipes.
+// An entry opens a segment and an exit closes it. Any other swipe proves the user is on site,
+// so it opens a segment if none is open. An exit without open segment can't be dated and is ignored.
+// A segment never closed ends on the last swipe seen.
+func presenceSegments(swipes []Swipe) []PresenceSegment {
+	var segments []PresenceSegment
+	var current *PresenceSegment
+	for _, swipe := range swipes {
+		if current == nil {
+			if swipe.Direction == DOOR_EXIT {
+				continue
+			}
+			current = &PresenceSegment{Begin: swipe.Time}
+		}
+		current.End = swipe.Time
+		if swipe.Direction == DOOR_EXIT {
+			segments = append(segments, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		segments = append(segments, *current)
+	}
+	return segments
+}
+
+// userSegments returns the presence segments of a user, or its first -> last range if swipes weren't kept
+func userSegments(user User) []PresenceSegment {
+	if len(user.Swipes) == 0 {
+		if user.FirstAccess.IsZero() {
+			return nil
+		}
+		return []PresenceSegment{{Begin: user.FirstAccess, End: user.LastAccess}}
+	}
+	return presenceSegments(user.Swipes)
+}
+
+// presenceSpan returns the range from the first presence segment start to the last one end
+func presenceSpan(user User) (time.Time, time.Time) {
+	segments := userSegments(user)
+	if len(segments) == 0 {
+		return user.FirstAccess, user.LastAccess
+	}
+	return segments[0].Begin, segments[len(segments)-1].End
+}
+
+func formatSegments(segments []PresenceSegment, loc *time.Location) string {
+	var parts []string
+	for _, segment := range segments {
+		parts = append(parts, fmt.Sprintf("%s-%s", segment.Begin.In(loc).Format("15:04"), segment.End.In(loc).Format("15:04")))
+	}
+	return strings.Join(parts, ", ")
+}
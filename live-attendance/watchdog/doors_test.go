@@ -0,0 +1,140 @@
+package watchdog
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var testDay = time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+
+func at(clock string) time.Time {
+	parsed, _ := time.Parse("15:04", clock)
+	return testDay.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+}
+
+func swipe(clock string, direction string) Swipe {
+	return Swipe{Time: at(clock), Door: "door", Direction: direction}
+}
+
+func segment(begin, end string) PresenceSegment {
+	return PresenceSegment{Begin: at(begin), End: at(end)}
+}
+
+func TestPresenceSegments(t *testing.T) {
+	tests := []struct {
+		name   string
+		swipes []Swipe
+		want   []PresenceSegment
+	}{
+		{name: "no swipe"},
+		{
+			name:   "entry and exit",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "two visits",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT), swipe("13:00", DOOR_ENTRY), swipe("17:00", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+		},
+		{
+			name:   "exit without entry is ignored",
+			swipes: []Swipe{swipe("07:00", DOOR_EXIT), swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "second exit in a row is ignored",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT), swipe("12:05", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "internal swipe opens a segment",
+			swipes: []Swipe{swipe("09:00", DOOR_INTERNAL), swipe("12:00", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("09:00", "12:00")},
+		},
+		{
+			name:   "internal swipes extend the open segment",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("10:00", DOOR_INTERNAL), swipe("11:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT)},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "unclosed segment ends on the last swipe",
+			swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT), swipe("13:00", DOOR_ENTRY), swipe("15:00", DOOR_INTERNAL)},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "15:00")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := presenceSegments(test.swipes)
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("presenceSegments() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddSwipe(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         User
+		swipe        Swipe
+		wantAdded    bool
+		wantSwipes   int
+		wantDuration time.Duration
+	}{
+		{
+			name:         "first swipe",
+			swipe:        swipe("08:00", DOOR_ENTRY),
+			wantAdded:    true,
+			wantSwipes:   1,
+			wantDuration: 0,
+		},
+		{
+			name:         "exit closes the segment",
+			user:         User{Swipes: []Swipe{swipe("08:00", DOOR_ENTRY)}},
+			swipe:        swipe("12:00", DOOR_EXIT),
+			wantAdded:    true,
+			wantSwipes:   2,
+			wantDuration: 4 * time.Hour,
+		},
+		{
+			name:         "late swipe is sorted",
+			user:         User{Swipes: []Swipe{swipe("12:00", DOOR_EXIT)}},
+			swipe:        swipe("08:00", DOOR_ENTRY),
+			wantAdded:    true,
+			wantSwipes:   2,
+			wantDuration: 4 * time.Hour,
+		},
+		{
+			name:         "duplicate swipe is ignored",
+			user:         User{Swipes: []Swipe{swipe("08:00", DOOR_ENTRY), swipe("12:00", DOOR_EXIT)}, Duration: 4 * time.Hour},
+			swipe:        swipe("12:00", DOOR_EXIT),
+			wantAdded:    false,
+			wantSwipes:   2,
+			wantDuration: 4 * time.Hour,
+		},
+		{
+			name:         "state without swipes keeps first and last access",
+			user:         User{FirstAccess: at("08:00"), LastAccess: at("10:00")},
+			swipe:        swipe("12:00", DOOR_EXIT),
+			wantAdded:    true,
+			wantSwipes:   3,
+			wantDuration: 4 * time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := test.user
+			if added := addSwipe(&user, test.swipe); added != test.wantAdded {
+				t.Fatalf("addSwipe() = %v, want %v", added, test.wantAdded)
+			}
+			if len(user.Swipes) != test.wantSwipes {
+				t.Fatalf("got %d swipes, want %d", len(user.Swipes), test.wantSwipes)
+			}
+			if user.Duration != test.wantDuration {
+				t.Fatalf("Duration = %s, want %s", user.Duration, test.wantDuration)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"watchdog/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const historyFile = "history.db"
+
+var historyBucket = []byte("attendances")
+var historyDB *bolt.DB
+
+// One user's result for one watch period, kept after resetUserDuration
+type AttendanceRecord struct {
+	Campus          string            `json:"campus,omitempty"` // Empty on single campus setups
+	Day             string            `json:"day"`
+	PeriodStart     string            `json:"period_start"`
+	PeriodEnd       string            `json:"period_end"`
+	ControlAccessID int               `json:"control_access_id"`
+	Login42         string            `json:"login_42"`
+	ID42            string            `json:"id_42"`
+	IsApprentice    bool              `json:"is_apprentice"`
+	FirstAccess     time.Time         `json:"first_access"`
+	LastAccess      time.Time         `json:"last_access"`
+	Duration        time.Duration     `json:"duration"`
+	Credited        time.Duration     `json:"credited"`
+	CreditedRanges  []PresenceSegment `json:"credited_ranges,omitempty"` // What was posted, first/last access are the badge times
+	Status          string            `json:"status"`
+	PostError       string            `json:"post_error,omitempty"`
+	PostedToChronos bool              `json:"posted_to_chronos"`
+	RecordedAt      time.Time         `json:"recorded_at"`
+}
+
+type HistoryFilter struct {
+	Campus string // Empty for every campus
+	Login  string // Empty for every user
+	From   string // YYYY-MM-DD, inclusive. Empty for no lower bound
+	To     string // YYYY-MM-DD, inclusive. Empty for no upper bound
+}
+
+func initHistory() error {
+	if config.ConfigData.Storage.Directory == "" || storageReadOnly {
+		return nil
+	}
+	db, err := bolt.Open(filepath.Join(config.ConfigData.Storage.Directory, historyFile), 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("couldn't open history database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{historyBucket, outboxBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("couldn't create history buckets: %w", err)
+	}
+	historyDB = db
+	return nil
+}
+
+func CloseHistory() {
+	if historyDB != nil {
+		historyDB.Close()
+	}
+}
+
+// Keys are sorted by day first, so date ranges are a simple cursor walk
+func historyKey(record AttendanceRecord) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%d", record.Day, record.Campus, record.PeriodStart, strings.ToLower(record.Login42), record.ControlAccessID))
+}
+
+func (campus *Campus) newAttendanceRecord(user User, period *TimePeriod, day time.Time) AttendanceRecord {
+	record := AttendanceRecord{
+		Campus:          campus.Name,
+		Day:             day.Format("2006-01-02"),
+		ControlAccessID: user.ControlAccessID,
+		Login42:         user.Login42,
+		ID42:            user.ID42,
+		IsApprentice:    user.IsApprentice,
+		FirstAccess:     user.FirstAccess,
+		LastAccess:      user.LastAccess,
+		Duration:        user.Duration,
+		Credited:        user.Credited,
+		CreditedRanges:  user.CreditedRanges,
+		Status:          user.Status,
+		PostedToChronos: user.Status == POSTED,
+		RecordedAt:      time.Now(),
+	}
+	if period != nil {
+		record.PeriodStart = period.StartingTime.Format("15:04:05")
+		record.PeriodEnd = period.EndingTime.Format("15:04:05")
+	}
+	if user.Error != nil {
+		record.PostError = user.Error.Error()
+	}
+	return record
+}
+
+// recordAttendances stores the outcome of a post for every given user
+func (campus *Campus) recordAttendances(users []User, period *TimePeriod, day time.Time) {
+	if historyDB == nil || len(users) == 0 {
+		return
+	}
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		for _, user := range users {
+			record := campus.newAttendanceRecord(user, period, day)
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(historyKey(record), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		campus.Log(fmt.Sprintf("[HISTORY] ERROR: couldn't record attendances: %s", err.Error()))
+	}
+}
+
+// QueryHistory returns stored records matching the filter, ordered by day
+func QueryHistory(filter HistoryFilter) ([]AttendanceRecord, error) {
+	if historyDB == nil {
+		return nil, fmt.Errorf("history is disabled (no storage directory configured)")
+	}
+	var records []AttendanceRecord
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(historyBucket).Cursor()
+		for key, value := cursor.Seek([]byte(filter.From)); key != nil; key, value = cursor.Next() {
+			day := strings.SplitN(string(key), "|", 2)[0]
+			if filter.To != "" && day > filter.To {
+				break
+			}
+			var record AttendanceRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if filter.Login != "" && !strings.EqualFold(record.Login42, filter.Login) {
+				continue
+			}
+			if filter.Campus != "" && record.Campus != filter.Campus {
+				continue
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// creditedEarlier returns the time credited to a login on other watch periods of the same day, on this campus.
+// Attendances not posted yet count too: they are retried from the outbox, or posted by hand.
+func (campus *Campus) creditedEarlier(login string, day time.Time, period *TimePeriod) time.Duration {
+	if historyDB == nil {
+		return 0
+	}
+	dayKey := day.Format("2006-01-02")
+	records, err := QueryHistory(HistoryFilter{Login: login, From: dayKey, To: dayKey})
+	if err != nil {
+		campus.Log(fmt.Sprintf("[HISTORY] ERROR: couldn't read credited time of %s: %s", login, err.Error()))
+		return 0
+	}
+	var credited time.Duration
+	for _, record := range records {
+		if record.Campus != campus.Name || (period != nil && record.PeriodStart == period.StartingTime.Format("15:04:05")) {
+			continue
+		}
+		credited += record.Credited
+	}
+	return credited
+}
+
+// periodDay is the day attendances are attributed to: the day the watch period started
+func (campus *Campus) periodDay(period *TimePeriod, reference time.Time) time.Time {
+	if reference.IsZero() {
+		reference = campus.now()
+	}
+	reference = reference.In(campus.Location)
+	if period == nil {
+		return reference
+	}
+	start, _ := period.bounds(reference)
+	return start
+}
+
+// EventDay returns the day an event is attributed to: the start day of its watch period, or its own day outside watch periods
+func (campus *Campus) EventDay(timeStamp time.Time) time.Time {
+	return campus.periodDay(campus.getTimePeriodForTimeStamp(timeStamp), timeStamp)
+}
+
+// attendanceDay is the day a batch of users is attributed to: the start day of the watch period of their latest access
+func (campus *Campus) attendanceDay(users map[int]User, period *TimePeriod) time.Time {
+	var latest time.Time
+	for _, user := range users {
+		if user.LastAccess.After(latest) {
+			latest = user.LastAccess
+		}
+	}
+	return campus.periodDay(period, latest)
+}
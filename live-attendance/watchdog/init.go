@@ -10,17 +10,13 @@ import (
 	apiManager "github.com/TheKrainBow/go-api"
 )
 
-func init() {
-	AllUsers = make(map[int]User)
-}
-
-func initAccessControlAPI() error {
-	APIClient, err := apiManager.NewAPIClient(config.AccessControl, apiManager.APIClientInput{
+func (campus *Campus) initAccessControlAPI() error {
+	APIClient, err := apiManager.NewAPIClient(campus.accessControlClient(), apiManager.APIClientInput{
 		AuthType: apiManager.AuthTypeBasic,
-		Username: config.ConfigData.AccessControl.Username,
-		Password: config.ConfigData.AccessControl.Password,
-		Endpoint: config.ConfigData.AccessControl.Endpoint,
-		TestPath: config.ConfigData.AccessControl.TestPath,
+		Username: campus.AccessControl.Username,
+		Password: campus.AccessControl.Password,
+		Endpoint: campus.AccessControl.Endpoint,
+		TestPath: campus.AccessControl.TestPath,
 	})
 	if err != nil {
 		return fmt.Errorf("couldn't create access control api client: %w", err)
@@ -84,28 +80,42 @@ func initMailer() error {
 		Helo:       config.ConfigData.Mailer.Helo,
 		FromName:   config.ConfigData.Mailer.FromName,
 		FromMail:   config.ConfigData.Mailer.FromMail,
-		Recipients: config.ConfigData.Mailer.Recipients,
+		Recipients: config.ConfigData.Mailer.Recipients, // Campuses have their own, falling back on these ones
 	})
 	return nil
 }
 
-func initTimePeriod() error {
+func (campus *Campus) initTimePeriod() error {
 	watch := map[time.Weekday][][]string{}
-	watch[time.Monday] = config.ConfigData.Watchtime.Monday
-	watch[time.Tuesday] = config.ConfigData.Watchtime.Tuesday
-	watch[time.Wednesday] = config.ConfigData.Watchtime.Wednesday
-	watch[time.Thursday] = config.ConfigData.Watchtime.Thursday
-	watch[time.Friday] = config.ConfigData.Watchtime.Friday
-	watch[time.Saturday] = config.ConfigData.Watchtime.Saturday
-	watch[time.Sunday] = config.ConfigData.Watchtime.Sunday
-	InitWatchtime(watch)
+	watch[time.Monday] = campus.Watchtime.Monday
+	watch[time.Tuesday] = campus.Watchtime.Tuesday
+	watch[time.Wednesday] = campus.Watchtime.Wednesday
+	watch[time.Thursday] = campus.Watchtime.Thursday
+	watch[time.Friday] = campus.Watchtime.Friday
+	watch[time.Saturday] = campus.Watchtime.Saturday
+	watch[time.Sunday] = campus.Watchtime.Sunday
+	campus.InitWatchtime(watch)
+	return campus.initWatchtimeOverrides()
+}
+
+// initCampusesServices runs an init step on every campus, errors tell which campus failed
+func initCampusesServices(step func(campus *Campus) error) error {
+	for _, campus := range Campuses {
+		if err := step(campus); err != nil {
+			if campus.Name != "" {
+				return fmt.Errorf("campus %s: %w", campus.Name, err)
+			}
+			return err
+		}
+	}
 	return nil
 }
 
 func InitAPIs() error {
+	initCampuses()
 	Log("[WATCHDOG] ┌─ 🚀 Initializing APIs")
-	Log("[WATCHDOG] ├── 🪪  Initializing Access Control API")
-	err := initAccessControlAPI()
+	Log(fmt.Sprintf("[WATCHDOG] ├── 🪪  Initializing Access Control API (%d campuses)", len(Campuses)))
+	err := initCampusesServices((*Campus).initAccessControlAPI)
 	if err != nil {
 		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
 		os.Exit(1)
@@ -129,11 +139,45 @@ func InitAPIs() error {
 		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
 		os.Exit(1)
 	}
-	Log("[WATCHDOG] └── 📅 Initializing WorkTime")
-	err = initTimePeriod()
+	Log("[WATCHDOG] ├── 📅 Initializing WorkTime")
+	err = initWatchtimeBounds(config.ConfigData.Bounds.Start, config.ConfigData.Bounds.End)
+	if err == nil {
+		err = initCampusesServices((*Campus).initTimePeriod)
+	}
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
+	Log("[WATCHDOG] ├── 📏 Initializing Attendance Rules")
+	err = initRules()
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
+	Log("[WATCHDOG] ├── 📆 Initializing Closure Calendar")
+	err = initCampusesServices((*Campus).initCalendar)
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
+	Log("[WATCHDOG] ├── 🏫 Initializing Apprentice Rhythms")
+	err = initRhythms()
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
+	Log("[WATCHDOG] ├── 💾 Initializing State Store")
+	err = initCampusesServices((*Campus).initStateStore)
+	if err != nil {
+		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
+		os.Exit(1)
+	}
+	Log("[WATCHDOG] └── 🗄️  Initializing History Database")
+	err = initHistory()
 	if err != nil {
 		Log(fmt.Sprintf("ERROR: %s\n", err.Error()))
 		os.Exit(1)
 	}
+	startOutboxWorker()
 	return nil
 }
@@ -0,0 +1,45 @@
+package watchdog
+
+import (
+	"time"
+	"watchdog/config"
+
+	"github.com/TheKrainBow/42-watchdog/ledger"
+	apiManager "github.com/TheKrainBow/go-api"
+)
+
+// Name written in the ledger, so we know which tool posted an attendance
+const ledgerPostedBy = "live-attendance"
+
+var errAlreadyPosted = ledger.ErrAlreadyPosted
+
+// postingLedger returns the ledger shared with daily-attendance, reporting times on campus time
+func (campus *Campus) postingLedger() *ledger.Ledger {
+	postLedger := &ledger.Ledger{
+		Path:      config.ConfigData.Ledger.Path,
+		PostedBy:  ledgerPostedBy,
+		Location:  campus.Location,
+		Retention: time.Duration(config.ConfigData.Ledger.RetentionDays) * 24 * time.Hour,
+		Log:       func(msg string) { campus.Log("[LEDGER] " + msg) },
+	}
+	if config.ConfigData.Ledger.CheckChronos {
+		postLedger.ChronosGet = apiManager.GetClient(config.FTAttendance).Get
+	}
+	return postLedger
+}
+
+// postAttendanceOnce posts an attendance unless an overlapping one was already posted,
+// by this server, by daily-attendance, or directly on Chronos.
+func (campus *Campus) postAttendanceOnce(attendance APIAttendance) error {
+	begin, err := time.Parse(time.RFC3339, attendance.Begin_at)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.RFC3339, attendance.End_at)
+	if err != nil {
+		return err
+	}
+	return campus.postingLedger().PostOnce(attendance.User_id, begin, end, func() error {
+		return postAttendance(attendance)
+	})
+}
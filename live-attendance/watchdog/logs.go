@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
 )
 
 var logFile *os.File
@@ -23,8 +22,8 @@ func Log(msg string) {
 		fmt.Printf("\n")
 	} else {
 		msg = strings.TrimRight(msg, "\n")
-		fmt.Fprintf(logFile, "[%s] %s\n", time.Now().Format("02/01/2006 - 15:04:05 MST"), msg)
-		fmt.Printf("[%s] %s\n", time.Now().Format("02/01/2006 - 15:04:05 MST"), msg)
+		fmt.Fprintf(logFile, "[%s] %s\n", campusNow().Format("02/01/2006 - 15:04:05 MST"), msg)
+		fmt.Printf("[%s] %s\n", campusNow().Format("02/01/2006 - 15:04:05 MST"), msg)
 	}
 }
 
@@ -0,0 +1,129 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+	"watchdog/mailer"
+
+	apiManager "github.com/TheKrainBow/go-api"
+)
+
+type UserEmailV2 struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+}
+
+// Result of one notify_students run
+type NotifySummary struct {
+	Notified []string          `json:"notified"`
+	Failed   map[string]string `json:"failed"`
+	Skipped  int               `json:"skipped"` // Apprentices that badged in and out
+}
+
+var emailCache = map[string]string{}
+var emailCacheMutex sync.Mutex
+
+// fetchEmail returns the 42 email of a login, fetched once from the API v2
+func fetchEmail(login string) (string, error) {
+	emailCacheMutex.Lock()
+	email, ok := emailCache[login]
+	emailCacheMutex.Unlock()
+	if ok {
+		return email, nil
+	}
+
+	resp, err := apiManager.GetClient(config.FTv2).Get(fmt.Sprintf("/users/%s", strings.ToLower(login)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch user: %s", resp.Status)
+	}
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var res UserEmailV2
+	if err = json.Unmarshal(respBytes, &res); err != nil {
+		return "", err
+	}
+	if res.Email == "" {
+		return "", fmt.Errorf("user has no email")
+	}
+
+	emailCacheMutex.Lock()
+	emailCache[login] = res.Email
+	emailCacheMutex.Unlock()
+	return res.Email, nil
+}
+
+func notifyMailBody(user User, periodEnd string, loc *time.Location) string {
+	var htmlBody strings.Builder
+	htmlBody.WriteString(fmt.Sprintf("<p>Hello %s,</p>", user.Login42))
+	if user.FirstAccess.IsZero() {
+		htmlBody.WriteString("<p>Watchdog didn't see any badge usage from you today.</p>")
+	} else {
+		htmlBody.WriteString(fmt.Sprintf("<p>Watchdog only saw you badge once today, at %s.</p>", user.FirstAccess.In(loc).Format("15:04")))
+	}
+	if periodEnd != "" {
+		htmlBody.WriteString(fmt.Sprintf("<p>Please remember to badge out before <b>%s</b>, otherwise your attendance of today can't be posted.</p>", periodEnd))
+	} else {
+		htmlBody.WriteString("<p>Please remember to badge out before leaving, otherwise your attendance of today can't be posted.</p>")
+	}
+	htmlBody.WriteString(`<p style="font-size:11px; color:#888;">This is an automated message sent by Watchdog, please don't answer.</p>`)
+	return htmlBody.String()
+}
+
+// NotifyStudents mails every apprentice that didn't badge yet, or badged only once,
+// to remind them to badge out before the end of the watch period
+func (campus *Campus) NotifyStudents() NotifySummary {
+	campusLoc := campus.Location
+	summary := NotifySummary{Failed: map[string]string{}}
+
+	var toNotify []User
+	campus.AllUsersMutex.Lock()
+	for _, user := range campus.AllUsers {
+		if !user.IsApprentice || expectedAt(user.Login42, campus.now()) == DAY_COMPANY {
+			continue
+		}
+		if user.FirstAccess.IsZero() || user.FirstAccess.Equal(user.LastAccess) {
+			toNotify = append(toNotify, user)
+		} else {
+			summary.Skipped++
+		}
+	}
+	campus.AllUsersMutex.Unlock()
+	sort.Slice(toNotify, func(i, j int) bool {
+		return toNotify[i].Login42 < toNotify[j].Login42
+	})
+
+	periodEnd := ""
+	if period := campus.getCurrentTimePeriod(); period != nil {
+		periodEnd = period.EndingTime.Format("15:04")
+	}
+
+	campus.Log(fmt.Sprintf("[WATCHDOG] [NOTIFY] ┌─ Notifying %d apprentices", len(toNotify)))
+	for _, user := range toNotify {
+		email, err := fetchEmail(user.Login42)
+		if err == nil {
+			err = mailer.Send([]string{email}, "Watchdog"+campus.tag()+" – Don't forget to badge out", notifyMailBody(user, periodEnd, campusLoc), true)
+		}
+		if err != nil {
+			summary.Failed[user.Login42] = err.Error()
+			campus.Log(fmt.Sprintf("[WATCHDOG] [NOTIFY] ├── ❌ %-8s: %s", user.Login42, err.Error()))
+			continue
+		}
+		summary.Notified = append(summary.Notified, user.Login42)
+		campus.Log(fmt.Sprintf("[WATCHDOG] [NOTIFY] ├── ✅ %-8s: %s", user.Login42, email))
+	}
+	campus.Log(fmt.Sprintf("[WATCHDOG] [NOTIFY] └─ Done (%d notified, %d failed, %d skipped)", len(summary.Notified), len(summary.Failed), summary.Skipped))
+	return summary
+}
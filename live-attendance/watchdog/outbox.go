@@ -0,0 +1,297 @@
+package watchdog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+	"watchdog/mailer"
+
+	apiManager "github.com/TheKrainBow/go-api"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultOutboxRetryDelay = 5 * time.Minute
+	defaultOutboxMaxDelay   = 6 * time.Hour
+	outboxCheckInterval     = time.Minute
+)
+
+var outboxBucket = []byte("outbox")
+
+// outboxMutex prevents the worker and a manual retry from posting the same entry twice
+var outboxMutex sync.Mutex
+
+// Attendance that Chronos refused, waiting to be posted again
+type OutboxEntry struct {
+	ID         uint64        `json:"id"`
+	Campus     string        `json:"campus,omitempty"`
+	Login42    string        `json:"login_42"`
+	Attendance APIAttendance `json:"attendance"`
+	Attempts   int           `json:"attempts"`
+	LastError  string        `json:"last_error"`
+	CreatedAt  time.Time     `json:"created_at"`
+	NextRetry  time.Time     `json:"next_retry"`
+}
+
+func outboxKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func outboxDelays() (time.Duration, time.Duration) {
+	retryDelay, err := time.ParseDuration(config.ConfigData.Outbox.RetryDelay)
+	if err != nil || retryDelay <= 0 {
+		retryDelay = defaultOutboxRetryDelay
+	}
+	maxDelay, err := time.ParseDuration(config.ConfigData.Outbox.MaxDelay)
+	if err != nil || maxDelay <= 0 {
+		maxDelay = defaultOutboxMaxDelay
+	}
+	return retryDelay, maxDelay
+}
+
+// nextOutboxRetry doubles the delay after each failed attempt, up to MaxDelay
+func nextOutboxRetry(attempts int, from time.Time) time.Time {
+	retryDelay, maxDelay := outboxDelays()
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return from.Add(delay)
+}
+
+// postAttendance sends one attendance to Chronos
+func postAttendance(attendance APIAttendance) error {
+	resp, err := apiManager.GetClient(config.FTAttendance).Post("/attendances", attendance)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// queueAttendance stores a failed attendance in the outbox. Returns false if the outbox is disabled.
+func queueAttendance(campus string, login string, attendance APIAttendance, postErr error) bool {
+	if historyDB == nil {
+		return false
+	}
+	now := time.Now()
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry := OutboxEntry{
+			ID:         id,
+			Campus:     campus,
+			Login42:    login,
+			Attendance: attendance,
+			Attempts:   1,
+			LastError:  postErr.Error(),
+			CreatedAt:  now,
+			NextRetry:  nextOutboxRetry(1, now),
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(outboxKey(id), data)
+	})
+	if err != nil {
+		Log(fmt.Sprintf("[OUTBOX] ERROR: couldn't queue attendance of %s: %s", login, err.Error()))
+		return false
+	}
+	Log(fmt.Sprintf("[OUTBOX] 📥 Queued attendance of %s for retry", login))
+	return true
+}
+
+// ListOutbox returns every pending attendance, oldest first
+func ListOutbox() ([]OutboxEntry, error) {
+	if historyDB == nil {
+		return nil, fmt.Errorf("outbox is disabled (no storage directory configured)")
+	}
+	var entries []OutboxEntry
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(key, value []byte) error {
+			var entry OutboxEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func saveOutboxEntry(entry OutboxEntry) error {
+	return historyDB.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(outboxBucket).Put(outboxKey(entry.ID), data)
+	})
+}
+
+func deleteOutboxEntry(id uint64) (bool, error) {
+	found := false
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+		found = bucket.Get(outboxKey(id)) != nil
+		return bucket.Delete(outboxKey(id))
+	})
+	return found, err
+}
+
+// DropOutboxEntry removes a pending attendance without posting it
+func DropOutboxEntry(id uint64) error {
+	if historyDB == nil {
+		return fmt.Errorf("outbox is disabled (no storage directory configured)")
+	}
+	outboxMutex.Lock()
+	defer outboxMutex.Unlock()
+	found, err := deleteOutboxEntry(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no outbox entry with id %d", id)
+	}
+	Log(fmt.Sprintf("[OUTBOX] 🗑️  Dropped outbox entry %d", id))
+	return nil
+}
+
+// RetryOutbox posts pending attendances now. With force, entries are retried even if their backoff is not over.
+// id 0 means every entry. Returns the number of posted and still pending entries.
+func RetryOutbox(id uint64, force bool) (int, int, error) {
+	if historyDB == nil {
+		return 0, 0, fmt.Errorf("outbox is disabled (no storage directory configured)")
+	}
+	outboxMutex.Lock()
+	defer outboxMutex.Unlock()
+
+	entries, err := ListOutbox()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	var posted []OutboxEntry
+	pending := 0
+	found := id == 0
+	for _, entry := range entries {
+		if id != 0 && entry.ID != id {
+			continue
+		}
+		found = true
+		if !force && entry.NextRetry.After(now) {
+			pending++
+			continue
+		}
+		postErr := campusByName(entry.Campus).postAttendanceOnce(entry.Attendance)
+		if errors.Is(postErr, errAlreadyPosted) {
+			if _, err := deleteOutboxEntry(entry.ID); err != nil {
+				Log(fmt.Sprintf("[OUTBOX] ERROR: couldn't remove entry %d: %s", entry.ID, err.Error()))
+			}
+			Log(fmt.Sprintf("[OUTBOX] ⏭️  Dropped attendance of %s: %s", entry.Login42, postErr.Error()))
+			continue
+		}
+		if postErr != nil {
+			entry.Attempts++
+			entry.LastError = postErr.Error()
+			entry.NextRetry = nextOutboxRetry(entry.Attempts, now)
+			Log(fmt.Sprintf("[OUTBOX] ❌ Retry %d for %s failed: %s (next try at %s)", entry.Attempts, entry.Login42, entry.LastError, entry.NextRetry.In(campusByName(entry.Campus).Location).Format("02/01 15:04:05")))
+			if err := saveOutboxEntry(entry); err != nil {
+				Log(fmt.Sprintf("[OUTBOX] ERROR: couldn't update entry %d: %s", entry.ID, err.Error()))
+			}
+			pending++
+			continue
+		}
+		if _, err := deleteOutboxEntry(entry.ID); err != nil {
+			Log(fmt.Sprintf("[OUTBOX] ERROR: couldn't remove posted entry %d: %s", entry.ID, err.Error()))
+		}
+		Log(fmt.Sprintf("[OUTBOX] ✅ Posted delayed attendance of %s after %d attempts", entry.Login42, entry.Attempts+1))
+		posted = append(posted, entry)
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("no outbox entry with id %d", id)
+	}
+	mailDelayedPosts(posted)
+	return len(posted), pending, nil
+}
+
+func runOutboxWorker() {
+	for {
+		time.Sleep(outboxCheckInterval)
+		if _, _, err := RetryOutbox(0, false); err != nil {
+			Log(fmt.Sprintf("[OUTBOX] ERROR: %s", err.Error()))
+		}
+	}
+}
+
+func startOutboxWorker() {
+	if historyDB == nil {
+		return
+	}
+	go runOutboxWorker()
+}
+
+// mailDelayedPosts sends a follow-up of the daily report once delayed attendances went through,
+// to the recipients of the campus each attendance belongs to
+func mailDelayedPosts(entries []OutboxEntry) {
+	if len(entries) == 0 || !mailReports {
+		return
+	}
+	byCampus := map[*Campus][]OutboxEntry{}
+	for _, entry := range entries {
+		campus := campusByName(entry.Campus)
+		byCampus[campus] = append(byCampus[campus], entry)
+	}
+	for campus, entries := range byCampus {
+		campus.mailDelayedPosts(entries)
+	}
+}
+
+func (campus *Campus) mailDelayedPosts(entries []OutboxEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Login42 < entries[j].Login42
+	})
+	campusLoc := campus.Location
+	var htmlBody strings.Builder
+	htmlBody.WriteString("<h2>Watchdog" + campus.tag() + " – Delayed attendances posted</h2>")
+	htmlBody.WriteString(`<table style="border:2px solid #ccc; padding: 8px; border-collapse:collapse; background:#f9f9f9;">`)
+	for _, entry := range entries {
+		begin, _ := time.Parse(time.RFC3339, entry.Attendance.Begin_at)
+		end, _ := time.Parse(time.RFC3339, entry.Attendance.End_at)
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-family: Menlo, Consolas, 'Courier New', monospace; font-size: 13px; padding: 1px 20px; line-height: 1;">`)
+		htmlBody.WriteString(fmt.Sprintf(`<span style="color: green;">✅ %-8s</span>: %s %s-%s — posted after %d attempts (queued at %s)`,
+			entry.Login42,
+			begin.In(campusLoc).Format("02/01/2006"),
+			begin.In(campusLoc).Format("15:04:05"),
+			end.In(campusLoc).Format("15:04:05"),
+			entry.Attempts+1,
+			entry.CreatedAt.In(campusLoc).Format("02/01 15:04:05"),
+		))
+		htmlBody.WriteString(`</td></tr>`)
+	}
+	htmlBody.WriteString(`</table><p style="font-size:11px; color:#888;">Generated by Watchdog at ` + campus.now().Format("15:04:05") + `</p>`)
+	err := mailer.Send(campus.Recipients, fmt.Sprintf("Watchdog%s – Delayed attendances posted - %s", campus.tag(), campus.now().Format("02/01/2006")), htmlBody.String(), true)
+	if err != nil {
+		campus.Log(fmt.Sprintf("[OUTBOX] ERROR: couldn't send follow-up mail: %s", err.Error()))
+	}
+}
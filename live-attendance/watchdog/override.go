@@ -0,0 +1,248 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const watchtimeOverridesFile = "watchtime.json"
+
+const (
+	OVERRIDE_CONFIG  string = "config"
+	OVERRIDE_RUNTIME string = "runtime"
+)
+
+// Watch periods of a given day, replacing the ones of its weekday. No period means nothing is watched that day.
+type WatchtimeOverride struct {
+	Date    string       `json:"date"`
+	Periods [][]string   `json:"periods"`
+	Source  string       `json:"source"` // config or runtime (set with the client)
+	periods []TimePeriod // Valid periods, the ones in use
+}
+
+func (campus *Campus) notifyWatchtimeChanged() {
+	select {
+	case campus.watchtimeChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (campus *Campus) overrideOn(date string) (WatchtimeOverride, bool) {
+	if override, exists := campus.runtimeOverrides[date]; exists {
+		return override, true
+	}
+	override, exists := campus.configOverrides[date]
+	return override, exists
+}
+
+// periodsOn returns the watch periods of a day: its override if any, the ones of its weekday otherwise
+func (campus *Campus) periodsOn(day time.Time) []TimePeriod {
+	campus.watchtimeMutex.RLock()
+	defer campus.watchtimeMutex.RUnlock()
+	day = day.In(campus.Location)
+	if override, exists := campus.overrideOn(day.Format("2006-01-02")); exists {
+		return override.periods
+	}
+	return campus.watchtime[day.Weekday()]
+}
+
+// parseOverrideDate reads the date of an override, on campus time
+func (campus *Campus) parseOverrideDate(date string) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), campus.Location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid watchtime override date `%s` (expected YYYY-MM-DD)", date)
+	}
+	return day, nil
+}
+
+// validateOverride checks the periods of an override against the night period of the day before and the periods
+// of the day after, like checkWatchtime does for weekdays
+func (campus *Campus) validateOverride(override *WatchtimeOverride) ([]string, error) {
+	day, err := campus.parseOverrideDate(override.Date)
+	if err != nil {
+		return nil, err
+	}
+	override.Date = day.Format("2006-01-02")
+	var periods []TimePeriod
+	for _, ranges := range override.Periods {
+		period, err := parseTimePeriod(ranges)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", override.Date, err)
+		}
+		periods = append(periods, period)
+	}
+
+	campus.Log(fmt.Sprintf("[WATCHDOG] ├── %s (override)\n", override.Date))
+	valid, discarded := validatePeriods(periods, lastNight(campus.periodsOn(day.AddDate(0, 0, -1))))
+	if night := lastNight(valid); night != nil {
+		if next := campus.periodsOn(day.AddDate(0, 0, 1)); len(next) > 0 && AfterTime(night.EndingTime, next[0].StartingTime) {
+			bounds := fmt.Sprintf("%s -> %s", night.StartingTime.Format("15:04:05"), night.EndingTime.Format("15:04:05"))
+			campus.Log(fmt.Sprintf("[WATCHDOG] ├─ %s (Discarded, overlapping next day periods)", bounds))
+			discarded = append(discarded, fmt.Sprintf("%s: overlapping next day periods", bounds))
+			valid = valid[:len(valid)-1]
+		}
+	}
+	override.periods = valid
+	return discarded, nil
+}
+
+// initWatchtimeOverrides loads dated overrides from config and the ones set at runtime
+func (campus *Campus) initWatchtimeOverrides() error {
+	var definitions []WatchtimeOverride
+	for date, periods := range campus.Watchtime.Overrides {
+		definitions = append(definitions, WatchtimeOverride{Date: date, Periods: periods, Source: OVERRIDE_CONFIG})
+	}
+	if dir := campus.storageDirectory(); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, watchtimeOverridesFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("couldn't read saved watchtime overrides: %w", err)
+		}
+		if err == nil {
+			var saved []WatchtimeOverride
+			if err = json.Unmarshal(data, &saved); err != nil {
+				return fmt.Errorf("couldn't read saved watchtime overrides: %w", err)
+			}
+			definitions = append(definitions, saved...)
+		}
+	}
+	// Validate in date order, so each override is checked against the ones of the day before
+	sort.SliceStable(definitions, func(i, j int) bool {
+		return definitions[i].Date < definitions[j].Date
+	})
+
+	campus.Log("[WATCHDOG] ┌─ Watchtime overrides")
+	for _, override := range definitions {
+		if _, err := campus.validateOverride(&override); err != nil {
+			return err
+		}
+		campus.watchtimeMutex.Lock()
+		if override.Source == OVERRIDE_RUNTIME {
+			campus.runtimeOverrides[override.Date] = override
+		} else {
+			campus.configOverrides[override.Date] = override
+		}
+		campus.watchtimeMutex.Unlock()
+	}
+	if len(definitions) == 0 {
+		campus.Log("[WATCHDOG] ├─ None")
+	}
+	campus.Log("[WATCHDOG] └─ Done")
+	return nil
+}
+
+// saveWatchtimeOverrides keeps runtime overrides across restarts. watchtimeMutex must be held.
+func (campus *Campus) saveWatchtimeOverrides() {
+	dir := campus.storageDirectory()
+	if dir == "" || storageReadOnly {
+		return
+	}
+	saved := []WatchtimeOverride{}
+	for _, override := range campus.runtimeOverrides {
+		saved = append(saved, override)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		campus.Log(fmt.Sprintf("[WATCHDOG] ERROR: couldn't encode watchtime overrides: %s", err.Error()))
+		return
+	}
+	if err = os.WriteFile(filepath.Join(dir, watchtimeOverridesFile), data, 0644); err != nil {
+		campus.Log(fmt.Sprintf("[WATCHDOG] ERROR: couldn't save watchtime overrides: %s", err.Error()))
+	}
+}
+
+// ListWatchtimeOverrides returns the overrides in use, ordered by date
+func (campus *Campus) ListWatchtimeOverrides() []WatchtimeOverride {
+	campus.watchtimeMutex.RLock()
+	defer campus.watchtimeMutex.RUnlock()
+	list := make([]WatchtimeOverride, 0, len(campus.configOverrides)+len(campus.runtimeOverrides))
+	for date := range campus.configOverrides {
+		if _, replaced := campus.runtimeOverrides[date]; !replaced {
+			list = append(list, campus.configOverrides[date])
+		}
+	}
+	for _, override := range campus.runtimeOverrides {
+		list = append(list, override)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date < list[j].Date
+	})
+	return list
+}
+
+// applyWatchtimeChange updates overrides, then follows the current watch period if it is still running with new bounds.
+// The watchtime scheduler is woken up to open or close periods according to the new ones.
+func (campus *Campus) applyWatchtimeChange(change func()) {
+	campus.timePeriodMutex.Lock()
+	campus.watchtimeMutex.Lock()
+	change()
+	campus.saveWatchtimeOverrides()
+	campus.watchtimeMutex.Unlock()
+	if campus.currentTimePeriod != nil {
+		if period := campus.findTimePeriod(campus.now()); period != nil && period.StartingTime.Equal(campus.currentTimePeriod.StartingTime) {
+			campus.currentTimePeriod = period
+		}
+	}
+	campus.timePeriodMutex.Unlock()
+	campus.notifyWatchtimeChanged()
+}
+
+// SetWatchtimeOverride replaces the watch periods of a day. Periods that checkWatchtime would discard are refused.
+func (campus *Campus) SetWatchtimeOverride(date string, periods [][]string) (WatchtimeOverride, error) {
+	override := WatchtimeOverride{Date: date, Periods: periods, Source: OVERRIDE_RUNTIME}
+	if override.Periods == nil {
+		override.Periods = [][]string{}
+	}
+	discarded, err := campus.validateOverride(&override)
+	if err != nil {
+		return override, err
+	}
+	if len(discarded) > 0 {
+		return override, fmt.Errorf("invalid watch periods for %s: %s", date, strings.Join(discarded, ", "))
+	}
+	campus.applyWatchtimeChange(func() {
+		campus.runtimeOverrides[override.Date] = override
+	})
+	campus.Log(fmt.Sprintf("[WATCHDOG] ➕ Watchtime of %s set to %s", override.Date, override))
+	return override, nil
+}
+
+// ClearWatchtimeOverride removes the runtime override of a day
+func (campus *Campus) ClearWatchtimeOverride(date string) error {
+	day, err := campus.parseOverrideDate(date)
+	if err != nil {
+		return err
+	}
+	date = day.Format("2006-01-02")
+	campus.watchtimeMutex.RLock()
+	_, exists := campus.runtimeOverrides[date]
+	_, fromConfig := campus.configOverrides[date]
+	campus.watchtimeMutex.RUnlock()
+	if !exists {
+		if fromConfig {
+			return fmt.Errorf("watchtime override of %s comes from config, edit it there", date)
+		}
+		return fmt.Errorf("no watchtime override on %s", date)
+	}
+	campus.applyWatchtimeChange(func() {
+		delete(campus.runtimeOverrides, date)
+	})
+	campus.Log(fmt.Sprintf("[WATCHDOG] ➖ Watchtime override of %s cleared", date))
+	return nil
+}
+
+func (override WatchtimeOverride) String() string {
+	if len(override.periods) == 0 {
+		return "no watch period"
+	}
+	var periods []string
+	for _, period := range override.periods {
+		periods = append(periods, fmt.Sprintf("%s-%s", period.StartingTime.Format("15:04:05"), period.EndingTime.Format("15:04:05")))
+	}
+	return strings.Join(periods, ", ")
+}
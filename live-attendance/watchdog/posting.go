@@ -0,0 +1,90 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+// userAttendances splits a user's presence in the running watch period into the attendances to post,
+// following 42Attendance.postStrategy, then applies attendance rules and sets the user's credited time.
+// Each watch period is always posted on its own.
+func (campus *Campus) userAttendances(user *User, id42 int) []APIAttendance {
+	var ranges []PresenceSegment
+	// Segments are the default: a span also credits the time spent outside between two badges
+	if config.ConfigData.Attendance42.PostStrategy == config.PostStrategySpan {
+		begin, end := presenceSpan(*user)
+		ranges = append(ranges, PresenceSegment{Begin: begin, End: end})
+	} else {
+		for _, segment := range userSegments(*user) {
+			if segment.Duration() > 0 {
+				ranges = append(ranges, segment)
+			}
+		}
+	}
+	var period *PresenceSegment
+	if campus.currentTimePeriod != nil {
+		start, end := campus.currentTimePeriod.bounds(user.LastAccess.In(campus.Location))
+		period = &PresenceSegment{Begin: start, End: end}
+	}
+	ranges = applyRules(ranges, period, campus.creditedEarlier(user.Login42, campus.periodDay(campus.currentTimePeriod, user.LastAccess), campus.currentTimePeriod))
+	user.Credited = totalDuration(ranges)
+	user.CreditedRanges = ranges
+
+	attendances := make([]APIAttendance, 0, len(ranges))
+	for _, segment := range ranges {
+		attendances = append(attendances, APIAttendance{
+			Begin_at:  segment.Begin.UTC().Format(time.RFC3339),
+			End_at:    segment.End.UTC().Format(time.RFC3339),
+			Source:    campus.AttendanceSource,
+			Campus_id: campus.ID,
+			User_id:   id42,
+		})
+	}
+	return attendances
+}
+
+// postUserAttendances posts the attendances of a user and sets its status.
+// Failed attendances are queued in the outbox, the other ones stay posted.
+func (campus *Campus) postUserAttendances(user *User, attendances []APIAttendance) {
+	if len(attendances) == 0 {
+		user.Status = NOTHING_CREDITED
+		user.Error = nil
+		return
+	}
+	posted := 0
+	var alreadyPosted error
+	var failures []string
+	for _, attendance := range attendances {
+		err := campus.postAttendanceOnce(attendance)
+		switch {
+		case errors.Is(err, errAlreadyPosted):
+			alreadyPosted = err
+		case err != nil:
+			if queueAttendance(campus.Name, user.Login42, attendance, err) {
+				err = fmt.Errorf("%s (queued for retry)", err.Error())
+			}
+			failures = append(failures, err.Error())
+		default:
+			posted++
+		}
+	}
+
+	switch {
+	case len(failures) > 0:
+		user.Status = POST_ERROR
+		if len(attendances) > 1 {
+			user.Error = fmt.Errorf("%d/%d attendances failed: %s", len(failures), len(attendances), strings.Join(failures, ", "))
+		} else {
+			user.Error = errors.New(failures[0])
+		}
+	case posted == 0 && alreadyPosted != nil:
+		user.Status = ALREADY_POSTED
+		user.Error = alreadyPosted
+	default:
+		user.Status = POSTED
+		user.Error = nil
+	}
+}
@@ -0,0 +1,114 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"watchdog/config"
+)
+
+const (
+	defaultQueueWorkers  = 4
+	defaultQueueCapacity = 1000
+)
+
+// Badge event waiting to be processed by UpdateUserAccess
+type AccessEvent struct {
+	Campus     *Campus
+	UserID     int
+	UserName   string
+	Time       time.Time
+	DoorName   string
+	DeviceName string
+}
+
+var ErrQueueFull = errors.New("event queue is full")
+var ErrQueueClosed = errors.New("event queue is closed")
+
+// One channel per worker. Events of a user always go to the same worker, whatever badge the user scanned, so they are processed in order.
+var eventQueues []chan AccessEvent
+var eventQueueCapacity int
+var eventQueueDepth atomic.Int64
+var eventQueueWG sync.WaitGroup
+var eventQueueClosed bool
+var eventQueueMutex sync.RWMutex
+
+func runEventWorker(queue chan AccessEvent) {
+	defer eventQueueWG.Done()
+	for event := range queue {
+		event.Campus.UpdateUserAccess(event.UserID, event.UserName, event.Time, event.DoorName, event.DeviceName)
+		eventQueueDepth.Add(-1)
+	}
+}
+
+// StartEventQueue starts the workers processing webhook events
+func StartEventQueue() {
+	workers := config.ConfigData.Queue.Workers
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	eventQueueCapacity = config.ConfigData.Queue.Capacity
+	if eventQueueCapacity <= 0 {
+		eventQueueCapacity = defaultQueueCapacity
+	}
+	perWorker := max(eventQueueCapacity/workers, 1)
+
+	eventQueues = make([]chan AccessEvent, workers)
+	for i := range eventQueues {
+		eventQueues[i] = make(chan AccessEvent, perWorker)
+		eventQueueWG.Add(1)
+		go runEventWorker(eventQueues[i])
+	}
+	Log(fmt.Sprintf("[WATCHDOG] 📬 Event queue started (%d workers, capacity %d)", workers, eventQueueCapacity))
+}
+
+// EnqueueEvent queues an event without blocking. Returns ErrQueueFull when the caller should retry later.
+func EnqueueEvent(event AccessEvent) error {
+	eventQueueMutex.RLock()
+	defer eventQueueMutex.RUnlock()
+	if eventQueueClosed || len(eventQueues) == 0 {
+		return ErrQueueClosed
+	}
+
+	shard := event.Campus.userKey(event.UserID) % len(eventQueues)
+	if shard < 0 {
+		shard = -shard
+	}
+	if eventQueueDepth.Add(1) > int64(eventQueueCapacity) {
+		eventQueueDepth.Add(-1)
+		return ErrQueueFull
+	}
+	select {
+	case eventQueues[shard] <- event:
+		return nil
+	default:
+		eventQueueDepth.Add(-1)
+		return ErrQueueFull
+	}
+}
+
+// EventQueueDepth returns the number of queued events not processed yet
+func EventQueueDepth() (int, int) {
+	return int(eventQueueDepth.Load()), eventQueueCapacity
+}
+
+// DrainEventQueue refuses new events and waits until queued ones are processed
+func DrainEventQueue() {
+	eventQueueMutex.Lock()
+	if eventQueueClosed {
+		eventQueueMutex.Unlock()
+		return
+	}
+	eventQueueClosed = true
+	for _, queue := range eventQueues {
+		close(queue)
+	}
+	eventQueueMutex.Unlock()
+
+	depth, _ := EventQueueDepth()
+	Log(fmt.Sprintf("[WATCHDOG] 📬 Draining event queue (%d events left)", depth))
+	eventQueueWG.Wait()
+	Log("[WATCHDOG] 📬 Event queue drained")
+}
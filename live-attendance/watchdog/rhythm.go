@@ -0,0 +1,103 @@
+package watchdog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+const (
+	DAY_SCHOOL  string = "school"
+	DAY_COMPANY string = "company"
+)
+
+type dateRange struct {
+	From string // YYYY-MM-DD
+	To   string // YYYY-MM-DD
+}
+
+func (r dateRange) contains(day string) bool {
+	return day >= r.From && day <= r.To
+}
+
+type rhythm struct {
+	Name       string
+	SchoolDays map[time.Weekday]bool
+	School     []dateRange
+	Company    []dateRange
+}
+
+// Rhythm of each apprentice, by lowercase login. Apprentices without rhythm are expected every day.
+var rhythms = map[string]rhythm{}
+
+func parseDateRanges(name string, ranges []config.ConfigDateRange) ([]dateRange, error) {
+	var parsed []dateRange
+	for _, r := range ranges {
+		if r.To == "" {
+			r.To = r.From
+		}
+		from, err := time.Parse("2006-01-02", r.From)
+		if err != nil {
+			return nil, fmt.Errorf("rhythm %s: invalid date `%s`", name, r.From)
+		}
+		to, err := time.Parse("2006-01-02", r.To)
+		if err != nil || to.Before(from) {
+			return nil, fmt.Errorf("rhythm %s: invalid date `%s`", name, r.To)
+		}
+		parsed = append(parsed, dateRange{From: r.From, To: r.To})
+	}
+	return parsed, nil
+}
+
+func initRhythms() error {
+	loaded := map[string]rhythm{}
+	for _, definition := range config.ConfigData.Rhythms.Cohorts {
+		parsed := rhythm{Name: definition.Name, SchoolDays: map[time.Weekday]bool{}}
+		for _, name := range definition.SchoolDays {
+			day, ok := parseWeekday(strings.TrimSpace(name))
+			if !ok {
+				return fmt.Errorf("rhythm %s: invalid day `%s`", definition.Name, name)
+			}
+			parsed.SchoolDays[day] = true
+		}
+		var err error
+		if parsed.School, err = parseDateRanges(definition.Name, definition.School); err != nil {
+			return err
+		}
+		if parsed.Company, err = parseDateRanges(definition.Name, definition.Company); err != nil {
+			return err
+		}
+		// Later definitions win, so per-apprentice rhythms from the CSV replace their cohort
+		for _, login := range definition.Logins {
+			loaded[strings.ToLower(login)] = parsed
+		}
+	}
+	rhythms = loaded
+	Log(fmt.Sprintf("[RHYTHM] 🏫 Loaded rhythms of %d apprentices", len(loaded)))
+	return nil
+}
+
+// expectedAt tells if an apprentice is expected at school or at company on a day, given on campus time
+func expectedAt(login string, day time.Time) string {
+	r, ok := rhythms[strings.ToLower(login)]
+	if !ok {
+		return DAY_SCHOOL
+	}
+	date := day.Format("2006-01-02")
+	for _, company := range r.Company {
+		if company.contains(date) {
+			return DAY_COMPANY
+		}
+	}
+	for _, school := range r.School {
+		if school.contains(date) {
+			return DAY_SCHOOL
+		}
+	}
+	// A rhythm with only company ranges expects the apprentice at school the rest of the time
+	if r.SchoolDays[day.Weekday()] || (len(r.SchoolDays) == 0 && len(r.School) == 0) {
+		return DAY_SCHOOL
+	}
+	return DAY_COMPANY
+}
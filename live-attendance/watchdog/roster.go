@@ -0,0 +1,122 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"watchdog/config"
+
+	apiManager "github.com/TheKrainBow/go-api"
+)
+
+const rosterPageSize = 100
+
+type ProjectUserResponse struct {
+	Status string `json:"status"`
+	User   UserV2 `json:"user"`
+}
+
+var rosterMutex sync.Mutex
+
+// fetchProjectRoster returns every user of the campus with the given project in progress
+func (campus *Campus) fetchProjectRoster(projectID string) ([]UserV2, error) {
+	var users []UserV2
+	for page := 1; ; page++ {
+		resp, err := apiManager.GetClient(config.FTv2).Get(fmt.Sprintf("/projects/%s/projects_users?filter[campus]=%d&filter[status]=in_progress&page[size]=%d&page[number]=%d",
+			projectID, campus.ID, rosterPageSize, page))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("couldn't fetch project %s: %s", projectID, resp.Status)
+		}
+		respBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var res []ProjectUserResponse
+		if err = json.Unmarshal(respBytes, &res); err != nil {
+			return nil, err
+		}
+		for _, projectUser := range res {
+			if projectUser.Status == "in_progress" && projectUser.User.Login != "" {
+				users = append(users, projectUser.User)
+			}
+		}
+		if len(res) < rosterPageSize {
+			return users, nil
+		}
+	}
+}
+
+// LoadRoster seeds AllUsers with every apprentice of the campus, so the ones that never badge are reported.
+// Seeded apprentices use -ID42 as badge until they scan their real badge, which then replaces it.
+// Users no longer listed lose their apprentice flag, and the seeded ones that never badged are removed.
+func (campus *Campus) LoadRoster() {
+	if !config.ConfigData.ApiV2.LoadRoster {
+		return
+	}
+	rosterMutex.Lock()
+	defer rosterMutex.Unlock()
+
+	roster := map[string]UserV2{}
+	for _, projectID := range config.ConfigData.ApiV2.ApprenticeProjects {
+		users, err := campus.fetchProjectRoster(projectID)
+		if err != nil {
+			campus.Log(fmt.Sprintf("[WATCHDOG] [ROSTER] ERROR: %s", err.Error()))
+			return
+		}
+		for _, user := range users {
+			roster[strings.ToLower(user.Login)] = user
+		}
+	}
+
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+	known := map[string]bool{}
+	removed := 0
+	for id, user := range campus.AllUsers {
+		login := strings.ToLower(user.Login42)
+		_, listed := roster[login]
+		if listed {
+			known[login] = true
+		}
+		switch {
+		case !listed && id < 0 && user.FirstAccess.IsZero():
+			// Seeded by an earlier load and never seen on campus
+			delete(campus.AllUsers, id)
+			campus.persistDelete(id)
+			removed++
+		case listed != user.IsApprentice:
+			user.IsApprentice = listed
+			campus.AllUsers[id] = user
+			campus.persistUser(id, user)
+			campus.Log(fmt.Sprintf("[WATCHDOG] [ROSTER] 🔄 Updated %s: %t → %t", user.Login42, !listed, listed))
+		}
+	}
+
+	added := 0
+	for login, apprentice := range roster {
+		if known[login] {
+			continue
+		}
+		badge := -apprentice.ID
+		user := User{
+			ControlAccessID:   badge,
+			ControlAccessName: apprentice.Login,
+			Login42:           apprentice.Login,
+			ID42:              strconv.Itoa(apprentice.ID),
+			IsApprentice:      true,
+		}
+		campus.AllUsers[badge] = user
+		campus.persistUser(badge, user)
+		added++
+	}
+	campus.Log(fmt.Sprintf("[WATCHDOG] [ROSTER] 📋 Loaded %d apprentices from 42 API (%d new, %d no longer listed removed)", len(roster), added, removed))
+}
@@ -0,0 +1,155 @@
+package watchdog
+
+import (
+	"fmt"
+	"time"
+	"watchdog/config"
+)
+
+// Attendance rules of the CFA, parsed from the rules config section. Zero values disable a rule.
+type attendanceRules struct {
+	BreakAfter    time.Duration // Presence longer than this must include a break
+	BreakDuration time.Duration // Break deducted when no gap of this length was seen
+	MaxDaily      time.Duration // Maximum credited time per day, all watch periods included
+	Rounding      time.Duration // Credited time is rounded to the nearest multiple
+	ClampToPeriod bool          // Credited ranges never exceed the watch period bounds
+}
+
+var rules attendanceRules
+
+func parseRuleDuration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid rules.%s `%s`", name, value)
+	}
+	return duration, nil
+}
+
+func initRules() error {
+	var err error
+	parsed := attendanceRules{ClampToPeriod: config.ConfigData.Rules.ClampToPeriod}
+	if parsed.BreakAfter, err = parseRuleDuration("breakAfter", config.ConfigData.Rules.BreakAfter); err != nil {
+		return err
+	}
+	if parsed.BreakDuration, err = parseRuleDuration("breakDuration", config.ConfigData.Rules.BreakDuration); err != nil {
+		return err
+	}
+	if parsed.MaxDaily, err = parseRuleDuration("maxDaily", config.ConfigData.Rules.MaxDaily); err != nil {
+		return err
+	}
+	if parsed.Rounding, err = parseRuleDuration("rounding", config.ConfigData.Rules.Rounding); err != nil {
+		return err
+	}
+	if parsed.BreakAfter > 0 && parsed.BreakDuration == 0 {
+		return fmt.Errorf("rules.breakAfter needs a rules.breakDuration")
+	}
+	// The daily maximum counts the time credited on the earlier periods of the day, kept in the history database
+	if parsed.MaxDaily > 0 && config.ConfigData.Storage.Directory == "" {
+		return fmt.Errorf("rules.maxDaily needs the history database, set storage.directory")
+	}
+	if parsed.MaxDaily > 0 && storageReadOnly {
+		if config.ConfigData.Attendance42.AutoPost {
+			return fmt.Errorf("rules.maxDaily needs the history database, which replay doesn't open: posting could exceed it")
+		}
+		Log("[WATCHDOG] ⚠️  rules.maxDaily ignored: replay doesn't read the history database")
+		parsed.MaxDaily = 0
+	}
+	rules = parsed
+	return nil
+}
+
+func totalDuration(ranges []PresenceSegment) time.Duration {
+	var total time.Duration
+	for _, segment := range ranges {
+		total += segment.Duration()
+	}
+	return total
+}
+
+func clampRanges(ranges []PresenceSegment, period PresenceSegment) []PresenceSegment {
+	var clamped []PresenceSegment
+	for _, segment := range ranges {
+		if segment.Begin.Before(period.Begin) {
+			segment.Begin = period.Begin
+		}
+		if segment.End.After(period.End) {
+			segment.End = period.End
+		}
+		if segment.Duration() > 0 {
+			clamped = append(clamped, segment)
+		}
+	}
+	return clamped
+}
+
+// longestGap returns the longest time spent off site between two ranges
+func longestGap(ranges []PresenceSegment) time.Duration {
+	var longest time.Duration
+	for i := 1; i < len(ranges); i++ {
+		longest = max(longest, ranges[i].Begin.Sub(ranges[i-1].End))
+	}
+	return longest
+}
+
+// trimEnd removes the given duration from the end of the ranges, dropping the ones left empty
+func trimEnd(ranges []PresenceSegment, duration time.Duration) []PresenceSegment {
+	for duration > 0 && len(ranges) > 0 {
+		last := &ranges[len(ranges)-1]
+		if last.Duration() > duration {
+			last.End = last.End.Add(-duration)
+			return ranges
+		}
+		duration -= last.Duration()
+		ranges = ranges[:len(ranges)-1]
+	}
+	return ranges
+}
+
+// applyRules turns presence ranges into credited ranges. period is the watch period occurrence, nil if unknown.
+// alreadyCredited is the time credited earlier the same day, counted against the daily maximum.
+func applyRules(ranges []PresenceSegment, period *PresenceSegment, alreadyCredited time.Duration) []PresenceSegment {
+	ranges = append([]PresenceSegment(nil), ranges...)
+	var exit time.Time
+	if len(ranges) > 0 {
+		exit = ranges[len(ranges)-1].End
+	}
+	if rules.ClampToPeriod && period != nil {
+		ranges = clampRanges(ranges, *period)
+	}
+
+	if rules.BreakAfter > 0 && totalDuration(ranges) > rules.BreakAfter && longestGap(ranges) < rules.BreakDuration {
+		ranges = trimEnd(ranges, rules.BreakDuration)
+	}
+
+	if rules.Rounding > 0 && len(ranges) > 0 {
+		total := totalDuration(ranges)
+		rounded := total.Round(rules.Rounding)
+		last := &ranges[len(ranges)-1]
+		if rounded > total {
+			// Rounding up must not push the end past the real exit, nor past the watch period
+			limit := exit
+			if rules.ClampToPeriod && period != nil && period.End.Before(limit) {
+				limit = period.End
+			}
+			if last.End.Add(rounded - total).After(limit) {
+				rounded = total.Truncate(rules.Rounding)
+			}
+		}
+		if rounded > total {
+			last.End = last.End.Add(rounded - total)
+		} else {
+			ranges = trimEnd(ranges, total-rounded)
+		}
+	}
+
+	if rules.MaxDaily > 0 {
+		allowed := max(rules.MaxDaily-alreadyCredited, 0)
+		if total := totalDuration(ranges); total > allowed {
+			ranges = trimEnd(ranges, total-allowed)
+		}
+	}
+	return ranges
+}
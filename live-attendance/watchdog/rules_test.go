@@ -0,0 +1,133 @@
+package watchdog
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestApplyRules(t *testing.T) {
+	morning := segment("08:00", "12:10")
+	tests := []struct {
+		name            string
+		rules           attendanceRules
+		ranges          []PresenceSegment
+		period          *PresenceSegment
+		alreadyCredited time.Duration
+		want            []PresenceSegment
+	}{
+		{
+			name:   "no rule",
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+		},
+		{
+			name:   "clamp to period",
+			rules:  attendanceRules{ClampToPeriod: true},
+			ranges: []PresenceSegment{segment("06:00", "07:00"), segment("07:00", "19:00")},
+			period: &PresenceSegment{Begin: at("08:00"), End: at("18:00")},
+			want:   []PresenceSegment{segment("08:00", "18:00")},
+		},
+		{
+			name:   "clamp without period",
+			rules:  attendanceRules{ClampToPeriod: true},
+			ranges: []PresenceSegment{segment("07:00", "19:00")},
+			want:   []PresenceSegment{segment("07:00", "19:00")},
+		},
+		{
+			name:   "break deducted",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "17:00")},
+			want:   []PresenceSegment{segment("08:00", "16:00")},
+		},
+		{
+			name:   "break deducted when the gap is too short",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("12:30", "17:00")},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("12:30", "16:00")},
+		},
+		{
+			name:   "break deduction empties the last range",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "14:30"), segment("14:45", "15:15")},
+			want:   []PresenceSegment{segment("08:00", "14:00")},
+		},
+		{
+			name:   "break already taken",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+		},
+		{
+			name:   "no break under the threshold",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "13:00")},
+			want:   []PresenceSegment{segment("08:00", "13:00")},
+		},
+		{
+			name:   "rounding down",
+			rules:  attendanceRules{Rounding: 15 * time.Minute},
+			ranges: []PresenceSegment{segment("08:00", "12:05")},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "rounding up before the exit",
+			rules:  attendanceRules{BreakAfter: 6 * time.Hour, BreakDuration: time.Hour, Rounding: 15 * time.Minute},
+			ranges: []PresenceSegment{segment("08:00", "17:10")},
+			want:   []PresenceSegment{segment("08:00", "16:15")},
+		},
+		{
+			name:   "rounding up past the last exit truncates",
+			rules:  attendanceRules{Rounding: 15 * time.Minute},
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:10")},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "17:00")},
+		},
+		{
+			name:   "rounding up past the period end truncates",
+			rules:  attendanceRules{Rounding: 15 * time.Minute, ClampToPeriod: true},
+			ranges: []PresenceSegment{segment("08:00", "13:00")},
+			period: &morning,
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "rounding removes a short range",
+			rules:  attendanceRules{Rounding: 15 * time.Minute},
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "13:05")},
+			want:   []PresenceSegment{segment("08:00", "12:00")},
+		},
+		{
+			name:   "daily maximum",
+			rules:  attendanceRules{MaxDaily: 7 * time.Hour},
+			ranges: []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "18:00")},
+			want:   []PresenceSegment{segment("08:00", "12:00"), segment("13:00", "16:00")},
+		},
+		{
+			name:            "daily maximum counts earlier periods",
+			rules:           attendanceRules{MaxDaily: 7 * time.Hour},
+			ranges:          []PresenceSegment{segment("13:00", "18:00")},
+			alreadyCredited: 4 * time.Hour,
+			want:            []PresenceSegment{segment("13:00", "16:00")},
+		},
+		{
+			name:            "daily maximum already reached",
+			rules:           attendanceRules{MaxDaily: 7 * time.Hour},
+			ranges:          []PresenceSegment{segment("13:00", "18:00")},
+			alreadyCredited: 8 * time.Hour,
+		},
+	}
+	saved := rules
+	defer func() { rules = saved }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules = test.rules
+			input := slices.Clone(test.ranges)
+			got := applyRules(test.ranges, test.period, test.alreadyCredited)
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("applyRules() = %v, want %v", got, test.want)
+			}
+			if !slices.Equal(test.ranges, input) {
+				t.Fatalf("applyRules() changed its input to %v", test.ranges)
+			}
+		})
+	}
+}
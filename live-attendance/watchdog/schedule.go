@@ -0,0 +1,426 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"watchdog/config"
+)
+
+const scheduleFile = "schedule.json"
+const scheduleCheckInterval = 20 * time.Second
+
+const (
+	JOB_START_LISTEN        string = "start_listen"
+	JOB_STOP_LISTEN         string = "stop_listen"
+	JOB_POST_ATTENDANCES    string = "post_attendances"
+	JOB_NOTIFY_STUDENTS     string = "notify_students"
+	JOB_DAILY_REPORT        string = "daily_report"
+	JOB_DELETE_ALL_PISCINER string = "delete_all_pisciner"
+)
+
+const (
+	JOB_SOURCE_CONFIG  string = "config"
+	JOB_SOURCE_RUNTIME string = "runtime"
+)
+
+var jobActions = []string{
+	JOB_START_LISTEN,
+	JOB_STOP_LISTEN,
+	JOB_POST_ATTENDANCES,
+	JOB_NOTIFY_STUDENTS,
+	JOB_DAILY_REPORT,
+	JOB_DELETE_ALL_PISCINER,
+}
+
+type ScheduledJob struct {
+	ID      int               `json:"id"`
+	Time    string            `json:"time"` // On campus time
+	Days    []string          `json:"days"`
+	Action  string            `json:"action"`
+	Campus  string            `json:"campus,omitempty"`   // Empty to run on every campus
+	Source  string            `json:"source"`             // config or runtime (added with the client)
+	LastRun map[string]string `json:"last_run,omitempty"` // Day of last run (YYYY-MM-DD) per campus, so a job runs once a day
+}
+
+// Content of schedule.json: the runtime edits, merged over the config jobs on boot
+type savedSchedule struct {
+	NextID  int            `json:"next_id"`
+	Jobs    []ScheduledJob `json:"jobs"`              // Every job, the config ones too so they keep their ID
+	Removed []ScheduledJob `json:"removed,omitempty"` // Config jobs removed at runtime
+}
+
+// A job to run now on one campus
+type dueJob struct {
+	job    ScheduledJob
+	campus *Campus
+}
+
+var schedule []ScheduledJob
+var removedConfigJobs []ScheduledJob
+var scheduleNextID = 1
+var scheduleMutex sync.Mutex
+
+// newScheduledJob validates a job definition coming from config or from a command
+func newScheduledJob(job config.ConfigJob) (ScheduledJob, error) {
+	clock, err := time.Parse("15:04", job.Time)
+	if err != nil {
+		return ScheduledJob{}, fmt.Errorf("invalid time `%s` (expected HH:MM)", job.Time)
+	}
+	if !slices.Contains(jobActions, job.Action) {
+		return ScheduledJob{}, fmt.Errorf("unknown action `%s` (expected one of %s)", job.Action, strings.Join(jobActions, ", "))
+	}
+	var days []string
+	for _, day := range job.Days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if _, ok := parseWeekday(day); !ok {
+			return ScheduledJob{}, fmt.Errorf("invalid day `%s`", day)
+		}
+		days = append(days, day)
+	}
+	if job.Campus != "" {
+		if _, err := GetCampus(job.Campus); err != nil {
+			return ScheduledJob{}, err
+		}
+	}
+	return ScheduledJob{Time: clock.Format("15:04"), Days: days, Action: job.Action, Campus: job.Campus}, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := range 7 {
+		if strings.EqualFold(time.Weekday(day).String(), name) {
+			return time.Weekday(day), true
+		}
+	}
+	return time.Sunday, false
+}
+
+func (job ScheduledJob) runsOn(day time.Weekday) bool {
+	if len(job.Days) == 0 {
+		return true
+	}
+	for _, name := range job.Days {
+		if weekday, _ := parseWeekday(name); weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (job ScheduledJob) String() string {
+	days := "every day"
+	if len(job.Days) > 0 {
+		days = strings.Join(job.Days, ", ")
+	}
+	if job.Campus != "" {
+		days += " on " + job.Campus
+	}
+	if job.Source == JOB_SOURCE_RUNTIME {
+		days += ", added at runtime"
+	}
+	return fmt.Sprintf("#%d %s %s (%s)", job.ID, job.Time, job.Action, days)
+}
+
+// sameDefinition tells if two jobs run the same action at the same time, whatever their ID
+func (job ScheduledJob) sameDefinition(other ScheduledJob) bool {
+	return job.Time == other.Time && job.Action == other.Action && job.Campus == other.Campus && slices.Equal(job.Days, other.Days)
+}
+
+// takeDefinition removes the first job of the list with the same definition, and tells if one was found
+func takeDefinition(jobs *[]ScheduledJob, job ScheduledJob) (ScheduledJob, bool) {
+	for i, candidate := range *jobs {
+		if candidate.sameDefinition(job) {
+			*jobs = slices.Delete(*jobs, i, i+1)
+			return candidate, true
+		}
+	}
+	return ScheduledJob{}, false
+}
+
+// readSavedSchedule reads the runtime edits of the schedule. Schedules saved as a plain job list replaced the config:
+// they are read back as the config jobs they kept, plus added jobs and removed config jobs.
+func readSavedSchedule(dir string, configJobs []ScheduledJob) (savedSchedule, error) {
+	var saved savedSchedule
+	data, err := os.ReadFile(filepath.Join(dir, scheduleFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return saved, nil
+	}
+	if err != nil {
+		return saved, err
+	}
+	if trimmed := strings.TrimSpace(string(data)); !strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &saved)
+		return saved, err
+	}
+
+	var legacy []config.ConfigJob
+	if err = json.Unmarshal(data, &legacy); err != nil {
+		return saved, err
+	}
+	remaining := slices.Clone(configJobs)
+	for _, definition := range legacy {
+		job, err := newScheduledJob(definition)
+		if err != nil {
+			continue
+		}
+		job.Source = JOB_SOURCE_RUNTIME
+		if _, found := takeDefinition(&remaining, job); found {
+			job.Source = JOB_SOURCE_CONFIG
+		}
+		saved.Jobs = append(saved.Jobs, job)
+	}
+	saved.Removed = remaining
+	return saved, nil
+}
+
+// initSchedule loads the config jobs, and merges the runtime edits saved in the storage directory over them
+func initSchedule() error {
+	var configJobs []ScheduledJob
+	for _, definition := range config.ConfigData.Schedule {
+		job, err := newScheduledJob(definition)
+		if err != nil {
+			Log(fmt.Sprintf("[SCHEDULE] ⚠️  Config job %s %s discarded: %s", definition.Time, definition.Action, err.Error()))
+			continue
+		}
+		job.Source = JOB_SOURCE_CONFIG
+		configJobs = append(configJobs, job)
+	}
+	var saved savedSchedule
+	dir := config.ConfigData.Storage.Directory
+	if dir != "" {
+		var err error
+		if saved, err = readSavedSchedule(dir, configJobs); err != nil {
+			return fmt.Errorf("couldn't read saved schedule: %w", err)
+		}
+	}
+
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	schedule = nil
+	removedConfigJobs = nil
+	scheduleNextID = max(saved.NextID, 1)
+	for _, job := range saved.Jobs {
+		scheduleNextID = max(scheduleNextID, job.ID+1)
+	}
+	Log("[SCHEDULE] ┌─ Scheduled jobs")
+	savedConfigJobs := []ScheduledJob{}
+	for _, job := range saved.Jobs {
+		if job.Source == JOB_SOURCE_CONFIG {
+			savedConfigJobs = append(savedConfigJobs, job)
+		}
+	}
+	for _, job := range configJobs {
+		if removed, found := takeDefinition(&saved.Removed, job); found {
+			removedConfigJobs = append(removedConfigJobs, removed)
+			Log(fmt.Sprintf("[SCHEDULE] ├─ %s (Removed at runtime)", removed))
+			continue
+		}
+		if known, found := takeDefinition(&savedConfigJobs, job); found && known.ID > 0 {
+			job.ID = known.ID
+		} else {
+			job.ID = scheduleNextID
+			scheduleNextID++
+		}
+		schedule = append(schedule, job)
+		Log(fmt.Sprintf("[SCHEDULE] ├─ %s", job))
+	}
+	for _, job := range savedConfigJobs {
+		Log(fmt.Sprintf("[SCHEDULE] ├─ %s (No longer in config, dropped)", job))
+	}
+	for _, stored := range saved.Jobs {
+		if stored.Source != JOB_SOURCE_RUNTIME {
+			continue
+		}
+		job, err := newScheduledJob(config.ConfigJob{Time: stored.Time, Days: stored.Days, Action: stored.Action, Campus: stored.Campus})
+		if err != nil {
+			Log(fmt.Sprintf("[SCHEDULE] ├─ %s %s (Discarded, %s)", stored.Time, stored.Action, err.Error()))
+			continue
+		}
+		job.Source = JOB_SOURCE_RUNTIME
+		job.ID = stored.ID
+		if job.ID <= 0 {
+			job.ID = scheduleNextID
+			scheduleNextID++
+		}
+		schedule = append(schedule, job)
+		Log(fmt.Sprintf("[SCHEDULE] ├─ %s", job))
+	}
+	if len(schedule) == 0 {
+		Log("[SCHEDULE] ├─ None")
+	}
+	Log("[SCHEDULE] └─ Done")
+	// Keeps the IDs given to new config jobs
+	saveSchedule()
+	return nil
+}
+
+// saveSchedule keeps runtime edits and job IDs across restarts. scheduleMutex must be held.
+func saveSchedule() {
+	dir := config.ConfigData.Storage.Directory
+	if dir == "" || storageReadOnly {
+		return
+	}
+	saved := savedSchedule{NextID: scheduleNextID, Jobs: make([]ScheduledJob, 0, len(schedule)), Removed: removedConfigJobs}
+	for _, job := range schedule {
+		job.LastRun = nil
+		saved.Jobs = append(saved.Jobs, job)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		Log(fmt.Sprintf("[SCHEDULE] ERROR: couldn't encode schedule: %s", err.Error()))
+		return
+	}
+	if err = os.WriteFile(filepath.Join(dir, scheduleFile), data, 0644); err != nil {
+		Log(fmt.Sprintf("[SCHEDULE] ERROR: couldn't save schedule: %s", err.Error()))
+	}
+}
+
+// GetSchedule returns scheduled jobs, ordered by time
+func GetSchedule() []ScheduledJob {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	jobs := slices.Clone(schedule)
+	for i := range jobs {
+		jobs[i].LastRun = maps.Clone(jobs[i].LastRun)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Time < jobs[j].Time
+	})
+	return jobs
+}
+
+func AddScheduledJob(definition config.ConfigJob) (ScheduledJob, error) {
+	job, err := newScheduledJob(definition)
+	if err != nil {
+		return job, err
+	}
+	job.Source = JOB_SOURCE_RUNTIME
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	job.ID = scheduleNextID
+	scheduleNextID++
+	schedule = append(schedule, job)
+	saveSchedule()
+	Log(fmt.Sprintf("[SCHEDULE] ➕ Added job %s", job))
+	return job, nil
+}
+
+func RemoveScheduledJob(id int) error {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	for i, job := range schedule {
+		if job.ID == id {
+			schedule = append(schedule[:i], schedule[i+1:]...)
+			// Config jobs stay removed on next boot, until they change in the config
+			if job.Source == JOB_SOURCE_CONFIG {
+				job.LastRun = nil
+				removedConfigJobs = append(removedConfigJobs, job)
+			}
+			saveSchedule()
+			Log(fmt.Sprintf("[SCHEDULE] ➖ Removed job %s", job))
+			return nil
+		}
+	}
+	return fmt.Errorf("no scheduled job with id %d", id)
+}
+
+func (campus *Campus) runScheduledJob(job ScheduledJob) {
+	if closure, closed := campus.closureOn(campus.now()); closed {
+		campus.Log(fmt.Sprintf("[SCHEDULE] 🏖️  Skipping job %s, campus is closed (%s)", job, closure.Reason))
+		return
+	}
+	campus.Log(fmt.Sprintf("[SCHEDULE] ⏰ Running job %s", job))
+	switch job.Action {
+	case JOB_START_LISTEN:
+		campus.AllowEvents(true)
+	case JOB_STOP_LISTEN:
+		campus.AllowEvents(false)
+	case JOB_POST_ATTENDANCES:
+		campus.PostApprenticesAttendances()
+	case JOB_NOTIFY_STUDENTS:
+		campus.NotifyStudents()
+	case JOB_DAILY_REPORT:
+		campus.SendStatusReport()
+	case JOB_DELETE_ALL_PISCINER:
+		campus.DeleteAllPisciners()
+	}
+}
+
+// dueJobs marks and returns jobs that must run now. Each campus runs them at its own time.
+func dueJobs() []dueJob {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	var due []dueJob
+	for _, campus := range Campuses {
+		now := campus.now()
+		today := now.Format("2006-01-02")
+		clock := now.Format("15:04")
+		for i, job := range schedule {
+			if job.Campus != "" && job.Campus != campus.Name {
+				continue
+			}
+			if job.LastRun[campus.Name] == today || !job.runsOn(now.Weekday()) || clock < job.Time {
+				continue
+			}
+			if schedule[i].LastRun == nil {
+				schedule[i].LastRun = map[string]string{}
+			}
+			schedule[i].LastRun[campus.Name] = today
+			// Jobs are only caught up within their minute, a server started at noon doesn't run the 07:30 ones
+			if clock != job.Time {
+				continue
+			}
+			due = append(due, dueJob{job: schedule[i], campus: campus})
+		}
+	}
+	return due
+}
+
+// Closed to stop the job scheduler, and by the scheduler once stopped
+var schedulerStop chan struct{}
+var schedulerDone chan struct{}
+
+func runScheduler(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, due := range dueJobs() {
+			due.campus.runScheduledJob(due.job)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// StartScheduler runs the configured jobs at their time
+func StartScheduler() error {
+	if err := initSchedule(); err != nil {
+		return err
+	}
+	schedulerStop = make(chan struct{})
+	schedulerDone = make(chan struct{})
+	go runScheduler(schedulerStop, schedulerDone)
+	return nil
+}
+
+// StopScheduler stops the job scheduler and waits for the running jobs to end
+func StopScheduler() {
+	if schedulerStop == nil {
+		return
+	}
+	close(schedulerStop)
+	<-schedulerDone
+	schedulerStop = nil
+}
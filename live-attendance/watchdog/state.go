@@ -0,0 +1,289 @@
+package watchdog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"watchdog/config"
+)
+
+const (
+	stateSnapshotFile = "state.json"
+	stateJournalFile  = "state.journal"
+
+	defaultSnapshotEvery = 500
+)
+
+const (
+	journalOpSet    string = "set"
+	journalOpDelete string = "delete"
+)
+
+// Full copy of the users of a campus, rewritten on each compaction
+type stateSnapshot struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Users   map[int]User `json:"users"`
+}
+
+// Single write-ahead journal line, appended after each user change
+type stateJournalEntry struct {
+	Op   string    `json:"op"`
+	ID   int       `json:"id"`
+	User *User     `json:"user,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+var stateSnapshotEvery int
+
+// Replay reads the closures and watchtime overrides of the storage directory, but never writes to it
+var storageReadOnly bool
+
+// SetStorageReadOnly keeps the storage directory for reading only: no live state, history or outbox is opened
+func SetStorageReadOnly(readOnly bool) {
+	storageReadOnly = readOnly
+}
+
+func (campus *Campus) initStateStore() error {
+	if storageReadOnly {
+		return nil
+	}
+	campus.stateDirectory = campus.storageDirectory()
+	if campus.stateDirectory == "" {
+		return nil
+	}
+	stateSnapshotEvery = config.ConfigData.Storage.SnapshotEvery
+	if stateSnapshotEvery <= 0 {
+		stateSnapshotEvery = defaultSnapshotEvery
+	}
+	err := os.MkdirAll(campus.stateDirectory, 0755)
+	if err != nil {
+		return fmt.Errorf("couldn't create storage directory: %w", err)
+	}
+	campus.stateJournal, err = os.OpenFile(filepath.Join(campus.stateDirectory, stateJournalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open state journal: %w", err)
+	}
+	return nil
+}
+
+// StateEnabled tells if users are persisted on disk
+func StateEnabled() bool {
+	return len(Campuses) > 0 && Campuses[0].stateJournal != nil
+}
+
+func (campus *Campus) appendStateJournal(entry stateJournalEntry) {
+	if campus.stateJournal == nil {
+		return
+	}
+	campus.stateMutex.Lock()
+	defer campus.stateMutex.Unlock()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't encode journal entry: %s", err.Error()))
+		return
+	}
+	line = append(line, '\n')
+	if _, err = campus.stateJournal.Write(line); err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't write journal entry: %s", err.Error()))
+		return
+	}
+	if err = campus.stateJournal.Sync(); err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't sync journal: %s", err.Error()))
+	}
+	campus.stateJournalEntries++
+}
+
+// persistUser stores the new value of a user. AllUsersMutex must be held.
+func (campus *Campus) persistUser(id int, user User) {
+	campus.appendStateJournal(stateJournalEntry{Op: journalOpSet, ID: id, User: &user, At: time.Now()})
+	if campus.stateJournal != nil && campus.stateJournalEntries >= stateSnapshotEvery {
+		campus.saveStateSnapshot()
+	}
+}
+
+// persistDelete stores the removal of a user. AllUsersMutex must be held.
+func (campus *Campus) persistDelete(id int) {
+	campus.appendStateJournal(stateJournalEntry{Op: journalOpDelete, ID: id, At: time.Now()})
+}
+
+// saveStateSnapshot writes the campus users to disk and truncates the journal. AllUsersMutex must be held.
+func (campus *Campus) saveStateSnapshot() {
+	if campus.stateJournal == nil {
+		return
+	}
+	campus.stateMutex.Lock()
+	defer campus.stateMutex.Unlock()
+
+	data, err := json.Marshal(stateSnapshot{SavedAt: time.Now(), Users: campus.AllUsers})
+	if err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't encode snapshot: %s", err.Error()))
+		return
+	}
+
+	// Write to a temporary file first, so a crash never leaves a half written snapshot
+	path := filepath.Join(campus.stateDirectory, stateSnapshotFile)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't write snapshot: %s", err.Error()))
+		return
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't replace snapshot: %s", err.Error()))
+		return
+	}
+	if err = campus.stateJournal.Truncate(0); err != nil {
+		campus.Log(fmt.Sprintf("[STATE] ERROR: couldn't truncate journal: %s", err.Error()))
+		return
+	}
+	campus.stateJournalEntries = 0
+}
+
+func (campus *Campus) readStateSnapshot() (stateSnapshot, error) {
+	snapshot := stateSnapshot{Users: map[int]User{}}
+	data, err := os.ReadFile(filepath.Join(campus.stateDirectory, stateSnapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Users == nil {
+		snapshot.Users = map[int]User{}
+	}
+	return snapshot, nil
+}
+
+func (campus *Campus) replayStateJournal(users map[int]User) (time.Time, int, error) {
+	var lastWrite time.Time
+	count := 0
+	file, err := os.Open(filepath.Join(campus.stateDirectory, stateJournalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return lastWrite, count, nil
+	}
+	if err != nil {
+		return lastWrite, count, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry stateJournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash while appending can only corrupt the last line
+			campus.Log(fmt.Sprintf("[STATE] ⚠️  Ignoring unreadable journal entry: %s", err.Error()))
+			continue
+		}
+		switch entry.Op {
+		case journalOpSet:
+			if entry.User != nil {
+				users[entry.ID] = *entry.User
+			}
+		case journalOpDelete:
+			delete(users, entry.ID)
+		}
+		if entry.At.After(lastWrite) {
+			lastWrite = entry.At
+		}
+		count++
+	}
+	return lastWrite, count, scanner.Err()
+}
+
+// RestoreState reloads users saved by a previous run, on every campus.
+// If the watch period they belong to is over, their attendances are posted right away.
+func RestoreState() error {
+	if !StateEnabled() {
+		Log("[STATE] 💾 No storage directory configured, state won't survive restarts")
+		return nil
+	}
+	for _, campus := range Campuses {
+		if err := campus.restoreState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (campus *Campus) restoreState() error {
+	snapshot, err := campus.readStateSnapshot()
+	if err != nil {
+		return fmt.Errorf("couldn't read state snapshot: %w", err)
+	}
+	lastWrite, replayed, err := campus.replayStateJournal(snapshot.Users)
+	if err != nil {
+		return fmt.Errorf("couldn't replay state journal: %w", err)
+	}
+	if snapshot.SavedAt.After(lastWrite) {
+		lastWrite = snapshot.SavedAt
+	}
+
+	campus.AllUsersMutex.Lock()
+	campus.AllUsers = snapshot.Users
+	for badge, user := range snapshot.Users {
+		campus.setBadgeOwner(badge, user)
+	}
+	campus.saveStateSnapshot()
+	campus.AllUsersMutex.Unlock()
+	campus.Log(fmt.Sprintf("[STATE] 💾 Restored %d users (%d journal entries replayed)", len(snapshot.Users), replayed))
+
+	if !campus.hasPendingAccess() {
+		return nil
+	}
+
+	now := campus.now()
+	savedPeriod := campus.getTimePeriodForTimeStamp(lastWrite)
+	nowPeriod := campus.getTimePeriodForTimeStamp(now)
+	if savedPeriod != nil && savedPeriod == nowPeriod && campus.periodDay(savedPeriod, lastWrite).Equal(campus.periodDay(nowPeriod, now)) {
+		campus.timePeriodMutex.Lock()
+		campus.currentTimePeriod = nowPeriod
+		campus.timePeriodMutex.Unlock()
+		campus.Log(fmt.Sprintf("[STATE] 🕓 Resuming watch period [%s - %s]", nowPeriod.StartingTime.Format("15:04:05"), nowPeriod.EndingTime.Format("15:04:05")))
+		return nil
+	}
+
+	campus.Log(fmt.Sprintf("[STATE] 🕓 Restored watch period ended while server was down (last write at %s)", lastWrite.In(campus.Location).Format("02/01/2006 15:04:05")))
+	campus.timePeriodMutex.Lock()
+	campus.currentTimePeriod = savedPeriod
+	campus.postApprenticesAttendances()
+	campus.currentTimePeriod = nil
+	campus.timePeriodMutex.Unlock()
+	return nil
+}
+
+// IsPeriodOngoing tells if the watch period holding current users' data is still running
+func (campus *Campus) IsPeriodOngoing() bool {
+	period := campus.getCurrentTimePeriod()
+	return period != nil && campus.getTimePeriodForTimeStamp(campus.now()) == period
+}
+
+func (campus *Campus) hasPendingAccess() bool {
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+	for _, user := range campus.AllUsers {
+		if !user.FirstAccess.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func CloseState() {
+	for _, campus := range Campuses {
+		if campus.stateJournal == nil {
+			continue
+		}
+		campus.AllUsersMutex.Lock()
+		campus.saveStateSnapshot()
+		campus.AllUsersMutex.Unlock()
+		campus.stateJournal.Close()
+	}
+}
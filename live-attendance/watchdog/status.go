@@ -0,0 +1,124 @@
+package watchdog
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"watchdog/config"
+)
+
+// State of a campus, as returned to the clients
+type CampusStatus struct {
+	Campus    string        `json:"campus,omitempty"` // Empty on single campus setups
+	Timezone  string        `json:"timezone"`
+	Listening bool          `json:"listening"`
+	Period    *PeriodStatus `json:"period"` // Null outside watch periods
+	Users     []UserStatus  `json:"users"`
+}
+
+// Watch period running on a campus
+type PeriodStatus struct {
+	Day   string `json:"day"`   // Day the period started (YYYY-MM-DD), attendances are attributed to it
+	Start string `json:"start"` // On campus time
+	End   string `json:"end"`
+}
+
+type UserStatus struct {
+	Login42         string            `json:"login"`
+	ID42            string            `json:"id_42"`
+	ControlAccessID int               `json:"control_access_id"`
+	Profile         string            `json:"profile"`
+	IsApprentice    bool              `json:"is_apprentice"`
+	FirstAccess     time.Time         `json:"first_access,omitzero"` // Missing when the user didn't badge yet
+	LastAccess      time.Time         `json:"last_access,omitzero"`
+	DurationSeconds int64             `json:"duration_seconds"`
+	Segments        []PresenceSegment `json:"segments,omitempty"` // Time spent on site, between entry and exit badges
+	Status          string            `json:"status,omitempty"`
+}
+
+func (profile ProfileType) String() string {
+	switch profile {
+	case Staff:
+		return "staff"
+	case Pisciner:
+		return "pisciner"
+	case Student:
+		return "student"
+	}
+	return "unknown"
+}
+
+func newUserStatus(user User) UserStatus {
+	return UserStatus{
+		Login42:         user.Login42,
+		ID42:            user.ID42,
+		ControlAccessID: user.ControlAccessID,
+		Profile:         user.Profile.String(),
+		IsApprentice:    user.IsApprentice,
+		FirstAccess:     user.FirstAccess,
+		LastAccess:      user.LastAccess,
+		DurationSeconds: int64(user.Duration.Seconds()),
+		Segments:        userSegments(user),
+		Status:          user.Status,
+	}
+}
+
+// Status returns the listening flag, the running watch period and the users of the campus, sorted by login
+func (campus *Campus) Status() CampusStatus {
+	status := CampusStatus{
+		Campus:    campus.Name,
+		Timezone:  campus.Timezone,
+		Listening: campus.GetAllowEvents(),
+		Period:    campus.CurrentPeriod(),
+		Users:     []UserStatus{},
+	}
+	for _, user := range campus.SnapshotUsers() {
+		status.Users = append(status.Users, newUserStatus(user))
+	}
+	sort.Slice(status.Users, func(i, j int) bool {
+		return strings.ToLower(status.Users[i].Login42) < strings.ToLower(status.Users[j].Login42)
+	})
+	return status
+}
+
+// CurrentPeriod returns the running watch period, or nil outside watch periods
+func (campus *Campus) CurrentPeriod() *PeriodStatus {
+	period := campus.getCurrentTimePeriod()
+	if period == nil {
+		return nil
+	}
+	return &PeriodStatus{
+		Day:   campus.periodDay(period, campus.now()).Format("2006-01-02"),
+		Start: period.StartingTime.Format("15:04:05"),
+		End:   period.EndingTime.Format("15:04:05"),
+	}
+}
+
+// PreviewAttendances returns what would be recorded if the running watch period ended now, without posting anything.
+// Returns nil outside watch periods.
+func (campus *Campus) PreviewAttendances() []AttendanceRecord {
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+	if campus.currentTimePeriod == nil {
+		return nil
+	}
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+
+	day := campus.attendanceDay(campus.AllUsers, campus.currentTimePeriod)
+	records := []AttendanceRecord{}
+	for _, user := range campus.AllUsers {
+		if _, postable := campus.classifyUser(&user, day); postable {
+			if config.ConfigData.Attendance42.AutoPost {
+				user.Status = POST_PENDING
+			} else {
+				user.Status = POST_OFF
+			}
+		}
+		records = append(records, campus.newAttendanceRecord(user, campus.currentTimePeriod, day))
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return strings.ToLower(records[i].Login42) < strings.ToLower(records[j].Login42)
+	})
+	return records
+}
@@ -3,6 +3,7 @@ package watchdog
 import (
 	"fmt"
 	"time"
+	"watchdog/config"
 )
 
 func formatDuration(d time.Duration) string {
@@ -27,3 +28,17 @@ func formatDuration(d time.Duration) string {
 		return fmt.Sprintf("    (%02ds)    ", s)
 	}
 }
+
+// CampusLocation returns the timezone of the first campus, the local one until config is loaded.
+// It is used for what isn't tied to a campus, like logs. Watch periods and days use the timezone of their campus.
+func CampusLocation() *time.Location {
+	if location := config.ConfigData.Campus.Location; location != nil {
+		return location
+	}
+	return time.Local
+}
+
+// campusNow returns the current time on the first campus
+func campusNow() time.Time {
+	return time.Now().In(CampusLocation())
+}
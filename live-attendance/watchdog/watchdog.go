@@ -6,10 +6,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"watchdog/config"
 	"watchdog/mailer"
@@ -27,79 +27,96 @@ type UserV2 struct {
 	Login string `json:"login"`
 }
 
-var acceptEvents bool = false
-var acceptEventsMutex sync.Mutex
+var mailReports bool = true
 
 type TimePeriod struct {
 	StartingTime time.Time
 	EndingTime   time.Time
 }
 
-var watchtime map[time.Weekday][]TimePeriod
-var currentTimePeriod *TimePeriod
-
-func checkWatchtime() {
-	Log("[WATCHDOG] ┌─ Watch periods")
+func (campus *Campus) checkWatchtime() {
+	campus.Log("[WATCHDOG] ┌─ Watch periods")
 	// Iterate over each day of the week
 	for day := range 7 {
-		periods := watchtime[time.Weekday(day)]
-		Log(fmt.Sprintf("[WATCHDOG] ├── %s\n", time.Weekday(day)))
-
-		var validPeriods []TimePeriod
-		for i, period := range periods {
-			log := strings.Builder{}
-			log.WriteString(fmt.Sprintf("[WATCHDOG] ├─ %s -> %s", period.StartingTime.Format("15:04:05"), period.EndingTime.Format("15:04:05")))
-
-			if period.StartingTime.After(period.EndingTime) {
-				log.WriteString(" (Discarded, invalid time)")
-				Log(log.String())
-				continue
-			}
+		campus.Log(fmt.Sprintf("[WATCHDOG] ├── %s\n", time.Weekday(day)))
+		campus.watchtime[time.Weekday(day)], _ = validatePeriods(campus.watchtime[time.Weekday(day)], lastNight(campus.watchtime[time.Weekday((day+6)%7)]))
+	}
+	campus.Log("[WATCHDOG] └─ Done")
+}
 
-			if i > 0 && periods[i-1].EndingTime.After(period.StartingTime) {
-				log.WriteString(" (Discarded, overlapping periods)")
-				Log(log.String())
-				continue
-			}
+// validatePeriods logs the periods of a day and returns the valid ones, sorted by start, with the reason of each discarded one.
+// previousNight is the period of the day before that ends on this day, if any.
+func validatePeriods(periods []TimePeriod, previousNight *TimePeriod) ([]TimePeriod, []string) {
+	periods = slices.Clone(periods)
+	sort.SliceStable(periods, func(i, j int) bool {
+		return BeforeTime(periods[i].StartingTime, periods[j].StartingTime)
+	})
+	var validPeriods []TimePeriod
+	var discarded []string
+	for i, period := range periods {
+		log := strings.Builder{}
+		bounds := fmt.Sprintf("%s -> %s", period.StartingTime.Format("15:04:05"), period.EndingTime.Format("15:04:05"))
+		log.WriteString("[WATCHDOG] ├─ " + bounds)
 
-			if i > 0 && periods[i-1].EndingTime.After(period.StartingTime) {
-				log.WriteString(" (Discarded, Period must be in chronological order)")
-				Log(log.String())
-				continue
-			}
-			validPeriods = append(validPeriods, period)
+		reason := ""
+		switch {
+		case period.StartingTime.Equal(period.EndingTime):
+			reason = "invalid time"
+		case i > 0 && periods[i-1].crossesMidnight():
+			reason = "only the last period of a day can cross midnight"
+		case i > 0 && periods[i-1].EndingTime.After(period.StartingTime):
+			reason = "overlapping periods"
+		case previousNight != nil && AfterTime(previousNight.EndingTime, period.StartingTime):
+			reason = "overlapping previous night period"
+		}
+		if reason != "" {
+			log.WriteString(fmt.Sprintf(" (Discarded, %s)", reason))
 			Log(log.String())
+			discarded = append(discarded, fmt.Sprintf("%s: %s", bounds, reason))
+			continue
 		}
-
-		if len(periods) == 0 {
-			Log("[WATCHDOG] ├─ None")
+		if period.crossesMidnight() {
+			log.WriteString(" (Ends next day)")
 		}
-		watchtime[time.Weekday(day)] = validPeriods
+		validPeriods = append(validPeriods, period)
+		Log(log.String())
+	}
+
+	if len(periods) == 0 {
+		Log("[WATCHDOG] ├─ None")
 	}
-	Log("[WATCHDOG] └─ Done")
+	return validPeriods, discarded
 }
 
-func InitWatchtime(watch map[time.Weekday][][]string) {
-	watchtime = make(map[time.Weekday][]TimePeriod)
+func (campus *Campus) InitWatchtime(watch map[time.Weekday][][]string) {
+	campus.watchtime = make(map[time.Weekday][]TimePeriod)
 	for key, value := range watch {
 		for _, ranges := range value {
-			first, err := time.Parse("15:04:05", ranges[0])
+			period, err := parseTimePeriod(ranges)
 			if err != nil {
-				Log(fmt.Sprintf("[ERROR] Couldn't parse watchtime `%s`", ranges[0]))
+				campus.Log(fmt.Sprintf("[ERROR] %s", err.Error()))
 				continue
 			}
-			last, err := time.Parse("15:04:05", ranges[1])
-			if err != nil {
-				Log(fmt.Sprintf("[ERROR] Couldn't parse watchtime `%s`", ranges[1]))
-				continue
-			}
-			watchtime[key] = append(watchtime[key], TimePeriod{
-				StartingTime: first,
-				EndingTime:   last,
-			})
+			campus.watchtime[key] = append(campus.watchtime[key], period)
 		}
 	}
-	checkWatchtime()
+	campus.checkWatchtime()
+}
+
+// parseTimePeriod parses a ["HH:MM:SS", "HH:MM:SS"] watchtime range
+func parseTimePeriod(ranges []string) (TimePeriod, error) {
+	if len(ranges) != 2 {
+		return TimePeriod{}, fmt.Errorf("watchtime range %v must have a start and an end", ranges)
+	}
+	first, err := time.Parse("15:04:05", ranges[0])
+	if err != nil {
+		return TimePeriod{}, fmt.Errorf("couldn't parse watchtime `%s`", ranges[0])
+	}
+	last, err := time.Parse("15:04:05", ranges[1])
+	if err != nil {
+		return TimePeriod{}, fmt.Errorf("couldn't parse watchtime `%s`", ranges[1])
+	}
+	return TimePeriod{StartingTime: first, EndingTime: last}, nil
 }
 
 func AfterTime(time1, time2 time.Time) bool {
@@ -119,14 +136,42 @@ func BeforeTime(time1, time2 time.Time) bool {
 	return t1.Before(t2)
 }
 
-func getTimePeriodForTimeStamp(timeStamp time.Time) *TimePeriod {
-	periods := watchtime[timeStamp.Weekday()]
+// getTimePeriodForTimeStamp returns the watch period containing timeStamp, nil if none or if the campus
+// is closed on the day the period started
+func (campus *Campus) getTimePeriodForTimeStamp(timeStamp time.Time) *TimePeriod {
+	period := campus.findTimePeriod(timeStamp)
+	if period == nil {
+		return nil
+	}
+	if start, _ := period.bounds(timeStamp.In(campus.Location)); campus.isClosed(start) {
+		return nil
+	}
+	return period
+}
+
+func (campus *Campus) findTimePeriod(timeStamp time.Time) *TimePeriod {
+	timeStamp = timeStamp.In(campus.Location)
+	periods := campus.periodsOn(timeStamp)
 
 	for i, period := range periods {
-		if AfterTime(timeStamp, period.StartingTime) && BeforeTime(timeStamp, period.EndingTime) {
+		if period.crossesMidnight() {
+			if afterPeriodStart(timeStamp, period) {
+				return &periods[i]
+			}
+			continue
+		}
+		if afterPeriodStart(timeStamp, period) && beforePeriodEnd(timeStamp, period) {
 			return &periods[i]
 		}
 	}
+
+	// Night period started the day before
+	yesterday := campus.periodsOn(timeStamp.AddDate(0, 0, -1))
+	for i, period := range yesterday {
+		if period.crossesMidnight() && beforePeriodEnd(timeStamp, period) {
+			return &yesterday[i]
+		}
+	}
 	return nil
 }
 
@@ -168,31 +213,43 @@ func FetchMissingFields(login string, userID string) (string, string) {
 	return res[0].Login, strconv.FormatInt(int64(res[0].ID), 10)
 }
 
-func GetAllowEvents() bool {
+func (campus *Campus) GetAllowEvents() bool {
 	dest := false
-	acceptEventsMutex.Lock()
-	dest = acceptEvents
-	acceptEventsMutex.Unlock()
+	campus.acceptEventsMutex.Lock()
+	dest = campus.acceptEvents
+	campus.acceptEventsMutex.Unlock()
 	return dest
 }
 
-func AllowEvents(isAllowed bool) {
+// SetMailReports enables or disables the daily report mail sent after posting
+func SetMailReports(enabled bool) {
+	mailReports = enabled
+}
+
+func (campus *Campus) AllowEvents(isAllowed bool) {
 	if isAllowed {
-		Log("[WATCHDOG] 🟢 accepting incoming events")
+		campus.Log("[WATCHDOG] 🟢 accepting incoming events")
 	} else {
-		Log("[WATCHDOG] 🔴 refusing incoming events")
+		campus.Log("[WATCHDOG] 🔴 refusing incoming events")
 	}
-	acceptEventsMutex.Lock()
-	acceptEvents = isAllowed
-	acceptEventsMutex.Unlock()
+	campus.acceptEventsMutex.Lock()
+	campus.acceptEvents = isAllowed
+	campus.acceptEventsMutex.Unlock()
 }
 
-func GetBadgeByLogin(login string) int {
-	if AllUsersMutex.TryLock() {
-		AllUsersMutex.Lock()
-		defer AllUsersMutex.Unlock()
+// AllowEvents starts or stops listening on every campus
+func AllowEvents(isAllowed bool) {
+	for _, campus := range Campuses {
+		campus.AllowEvents(isAllowed)
 	}
-	for key, value := range AllUsers {
+}
+
+func (campus *Campus) GetBadgeByLogin(login string) int {
+	if campus.AllUsersMutex.TryLock() {
+		campus.AllUsersMutex.Lock()
+		defer campus.AllUsersMutex.Unlock()
+	}
+	for key, value := range campus.AllUsers {
 		if value.Login42 == login {
 			return key
 		}
@@ -200,15 +257,15 @@ func GetBadgeByLogin(login string) int {
 	return -1
 }
 
-func CreateNewUser(userID int, accessControlUsername string) (User, int, error) {
+func (campus *Campus) CreateNewUser(userID int, accessControlUsername string) (User, int, error) {
 	user := User{
 		ControlAccessID:   userID,
 		ControlAccessName: accessControlUsername,
 	}
 
-	resp, err := apiManager.GetClient(config.AccessControl).Get(fmt.Sprintf("/users/%d", userID))
+	resp, err := apiManager.GetClient(campus.accessControlClient()).Get(fmt.Sprintf("/users/%d", userID))
 	if err != nil {
-		Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
+		campus.Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
 		os.Exit(1)
 	}
 
@@ -216,14 +273,14 @@ func CreateNewUser(userID int, accessControlUsername string) (User, int, error)
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
+		campus.Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
 		os.Exit(1)
 	}
 
 	var res UserResponse
 	err = json.Unmarshal(bodyBytes, &res)
 	if err != nil {
-		Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
+		campus.Log(fmt.Sprintf("[WATCHDOG] ERROR: %s", err.Error()))
 		os.Exit(1)
 	}
 
@@ -242,7 +299,7 @@ func CreateNewUser(userID int, accessControlUsername string) (User, int, error)
 		return User{}, -1, fmt.Errorf("failed to fetch Login42('%s') OR ID42('%s')", user.Login42, user.ID42)
 	}
 
-	badgeID := GetBadgeByLogin(user.Login42)
+	badgeID := campus.GetBadgeByLogin(user.Login42)
 	if badgeID != -1 {
 		return user, badgeID, nil
 	}
@@ -255,103 +312,111 @@ func CreateNewUser(userID int, accessControlUsername string) (User, int, error)
 		}
 	}
 	if user.IsApprentice && user.Profile != Student {
-		Log(fmt.Sprintf("[WATCHDOG] ⚠️  Created a new user: %s is an apprentice with temporary badge", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  Created a new user: %s is an apprentice with temporary badge", user.Login42))
 	} else if user.IsApprentice {
-		Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is an apprentice", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is an apprentice", user.Login42))
 	} else if user.Profile == Pisciner {
-		Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a pisciner", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a pisciner", user.Login42))
 	} else if user.Profile == Student {
-		Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a basic student", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a basic student", user.Login42))
 	} else if user.Profile == Staff {
-		Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a Staff", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is a Staff", user.Login42))
 	} else {
-		Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is an extern", user.Login42))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 📋 Created a new user: %s is an extern", user.Login42))
 	}
 	return user, -1, nil
 }
 
-func UpdateUserAccess(userID int, accessControlUsername string, timeStamp time.Time, doorName string) {
+func (campus *Campus) UpdateUserAccess(userID int, accessControlUsername string, timeStamp time.Time, doorName string, deviceName string) {
 	var err error
 	var badge int
-	AllUsersMutex.Lock()
-	user, exist := AllUsers[userID]
+	scannedBadge := userID
+	campus.AllUsersMutex.Lock()
+	user, exist := campus.AllUsers[userID]
 	if !exist {
-		user, badge, err = CreateNewUser(userID, accessControlUsername)
+		user, badge, err = campus.CreateNewUser(userID, accessControlUsername)
 		if err != nil {
-			Log(fmt.Sprintf("[WATCHDOG] ❌ Failed to create user: %s\n", err.Error()))
-			AllUsersMutex.Unlock()
+			campus.Log(fmt.Sprintf("[WATCHDOG] ❌ Failed to create user: %s\n", err.Error()))
+			campus.AllUsersMutex.Unlock()
 			return
 		}
 		if badge != -1 {
-			Log(fmt.Sprintf("[WATCHDOG] ⚠️  User %s is already registered with another badge\n", user.Login42))
-			if user.Profile == Student { // Badge that scanned is a student account. We need to replace the temporary badge with this one
-				Log("[WATCHDOG] ⚠️  Stored badge is a temporary badge. Replacing with student badge\n")
+			campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  User %s is already registered with another badge\n", user.Login42))
+			if user.Profile == Student || badge < 0 { // Badge that scanned is a student account, or the stored one a roster placeholder. We need to replace the stored badge with this one
+				if badge < 0 {
+					campus.Log("[WATCHDOG] ⚠️  Stored badge is a roster placeholder. Replacing with scanned badge\n")
+				} else {
+					campus.Log("[WATCHDOG] ⚠️  Stored badge is a temporary badge. Replacing with student badge\n")
+				}
 				// Retrieve the user associated with the badge
-				existingUser := AllUsers[badge]
-				existingUser.Profile = Student
+				existingUser := campus.AllUsers[badge]
+				existingUser.Profile = user.Profile
 				existingUser.ControlAccessID = userID
 				existingUser.ControlAccessName = accessControlUsername
 
 				// Replace the temporary badge with the official badge
-				AllUsers[userID] = existingUser // Assign the updated user to the new badge
-				delete(AllUsers, badge)         // Remove the temporary badge entry
+				campus.AllUsers[userID] = existingUser // Assign the updated user to the new badge
+				delete(campus.AllUsers, badge)         // Remove the temporary badge entry
+				campus.persistUser(userID, existingUser)
+				campus.persistDelete(badge)
 			} else {
-				Log("[WATCHDOG] ⚠️  Used badge is a temporary badge. Logging User access on the real badge\n")
-				user = AllUsers[badge]
+				campus.Log("[WATCHDOG] ⚠️  Used badge is a temporary badge. Logging User access on the real badge\n")
+				user = campus.AllUsers[badge]
 				userID = badge
 			}
 		}
 	}
-	AllUsersMutex.Unlock()
+	campus.setBadgeOwner(scannedBadge, user)
+	campus.AllUsersMutex.Unlock()
 
-	isInWatchtime := getTimePeriodForTimeStamp(timeStamp)
-	if isInWatchtime != currentTimePeriod {
-		if isInWatchtime != nil {
-			Log(fmt.Sprintf("[WATCHDOG] 🕓 Watchtime changed: [%s - %s]", (*isInWatchtime).StartingTime.Format("15:04:05"), (*isInWatchtime).EndingTime.Format("15:04:05")))
-		} else {
-			Log("[WATCHDOG] 🕓 Watchtime changed: Watchdog went to sleep")
-		}
-		if currentTimePeriod != nil {
-			PostApprenticesAttendances()
-		}
-		currentTimePeriod = isInWatchtime
+	isInWatchtime := campus.getTimePeriodForTimeStamp(timeStamp)
+	if !campus.isWatchtimeSchedulerRunning() {
+		// Without scheduler (replay), events are the only clock we have
+		campus.updateTimePeriod(timeStamp)
 	}
 
 	if isInWatchtime == nil {
-		Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s, but watchdog is sleeping", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
+		campus.Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s, but watchdog is sleeping", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
+		return
+	}
+
+	if isInWatchtime != campus.getCurrentTimePeriod() {
+		campus.Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s, but this watch period is closed", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
 		return
 	}
 
-	if !acceptEvents {
-		Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s, but events are not accepted", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
+	if !campus.GetAllowEvents() {
+		campus.Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s, but events are not accepted", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
 		return
 	}
 
-	Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s at %s", user.Login42, doorName, timeStamp.Format("15:04:05 MST")))
-	if user.FirstAccess.IsZero() || user.FirstAccess.After(timeStamp) {
-		user.FirstAccess = timeStamp
-		user.Duration = user.LastAccess.Sub(user.FirstAccess)
+	direction := classifyDoor(doorName, deviceName)
+	campus.Log(fmt.Sprintf("[WATCHDOG] 🚪 User %s used door %s (%s) at %s", user.Login42, doorName, direction, timeStamp.Format("15:04:05 MST")))
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+	// The user may have changed since it was read, by a command or by the first event of another of its badges
+	if stored, ok := campus.AllUsers[userID]; ok {
+		user = stored
 	}
-	if user.LastAccess.IsZero() || user.LastAccess.Before(timeStamp) {
-		user.LastAccess = timeStamp
-		user.Duration = user.LastAccess.Sub(user.FirstAccess)
+	if !addSwipe(&user, Swipe{Time: timeStamp, Door: doorName, Direction: direction}) {
+		campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  Swipe of %s at %s already recorded, ignored", user.Login42, timeStamp.Format("15:04:05 MST")))
+		return
 	}
-	AllUsersMutex.Lock()
-	AllUsers[userID] = user
-	AllUsersMutex.Unlock()
+	campus.AllUsers[userID] = user
+	campus.persistUser(userID, user)
 }
 
-func PrintUsersTimers() {
-	parisLoc, _ := time.LoadLocation("Europe/Paris")
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) PrintUsersTimers() {
+	campusLoc := campus.Location
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	if len(AllUsers) == 0 {
-		Log("[WATCHDOG] No users saved")
+	if len(campus.AllUsers) == 0 {
+		campus.Log("[WATCHDOG] No users saved")
 		return
 	}
 
-	Log("[WATCHDOG] ┌─ Users status:")
+	campus.Log("[WATCHDOG] ┌─ Users status:")
 
 	var (
 		naNoBadge []User // non-apprentices no badge
@@ -360,7 +425,7 @@ func PrintUsersTimers() {
 		aBadge    []User // apprentices with badge
 	)
 
-	for _, user := range AllUsers {
+	for _, user := range campus.AllUsers {
 		switch {
 		case !user.IsApprentice && user.FirstAccess.IsZero():
 			naNoBadge = append(naNoBadge, user)
@@ -373,29 +438,30 @@ func PrintUsersTimers() {
 		}
 	}
 
-	printUserGroup("├──────── Basic students: No badge usage", naNoBadge, false, parisLoc)
-	printUserGroup("├──────── Basic students: Seen today", naBadge, true, parisLoc)
-	printUserGroup("├──────── Apprentices:    No badge usage", aNoBadge, false, parisLoc)
-	printUserGroup("├──────── Apprentices:    Seen today", aBadge, true, parisLoc)
+	campus.printUserGroup("├──────── Basic students: No badge usage", naNoBadge, false, campusLoc)
+	campus.printUserGroup("├──────── Basic students: Seen today", naBadge, true, campusLoc)
+	campus.printUserGroup("├──────── Apprentices:    No badge usage", aNoBadge, false, campusLoc)
+	campus.printUserGroup("├──────── Apprentices:    Seen today", aBadge, true, campusLoc)
 
-	Log("[WATCHDOG] └─ Done")
+	campus.Log("[WATCHDOG] └─ Done")
 }
 
-func printUserGroup(title string, users []User, showTimes bool, loc *time.Location) {
+func (campus *Campus) printUserGroup(title string, users []User, showTimes bool, loc *time.Location) {
 	if len(users) == 0 {
 		return
 	}
-	Log("[WATCHDOG] " + title)
+	campus.Log("[WATCHDOG] " + title)
 	for _, user := range users {
 		if showTimes {
-			Log(fmt.Sprintf("[WATCHDOG] ├── %8s: %s -> %s ┆ Total : %s\n",
+			campus.Log(fmt.Sprintf("[WATCHDOG] ├── %8s: %s -> %s ┆ Total : %s ┆ On site: %s\n",
 				user.Login42,
 				user.FirstAccess.In(loc).Format("15h04m05s"),
 				user.LastAccess.In(loc).Format("15h04m05s"),
 				formatDuration(user.Duration),
+				formatSegments(userSegments(user), loc),
 			))
 		} else {
-			Log(fmt.Sprintf("[WATCHDOG] ├── %8s: %s ┆ Total : %s\n",
+			campus.Log(fmt.Sprintf("[WATCHDOG] ├── %8s: %s ┆ Total : %s\n",
 				user.Login42,
 				"  No badge usage yet  ",
 				formatDuration(user.Duration),
@@ -404,6 +470,68 @@ func printUserGroup(title string, users []User, showTimes bool, loc *time.Locati
 	}
 }
 
+// SendStatusReport mails the apprentices' presence of the running period, without posting anything
+func (campus *Campus) SendStatusReport() {
+	campusLoc := campus.Location
+	var seen, notSeen, atCompany []User
+	campus.AllUsersMutex.Lock()
+	for _, user := range campus.AllUsers {
+		if !user.IsApprentice {
+			continue
+		}
+		if user.FirstAccess.IsZero() && expectedAt(user.Login42, campus.now()) == DAY_COMPANY {
+			atCompany = append(atCompany, user)
+		} else if user.FirstAccess.IsZero() {
+			notSeen = append(notSeen, user)
+		} else {
+			seen = append(seen, user)
+		}
+	}
+	campus.AllUsersMutex.Unlock()
+
+	if len(seen) == 0 && len(notSeen) == 0 && len(atCompany) == 0 {
+		campus.Log("[WATCHDOG] [REPORT] No apprentice registered, status report not sent")
+		return
+	}
+	for _, users := range [][]User{seen, notSeen, atCompany} {
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Login42 < users[j].Login42
+		})
+	}
+
+	today := campus.now()
+	var htmlBody strings.Builder
+	htmlBody.WriteString("<h2>Watchdog Status Report" + campus.tag() + " – " + today.Format("02/01/2006") + "</h2>")
+	htmlBody.WriteString(`<table style="border:2px solid #ccc; padding: 8px; border-collapse:collapse; background:#f9f9f9;">`)
+	for _, user := range seen {
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-family: Menlo, Consolas, 'Courier New', monospace; font-size: 13px; padding: 1px 20px; line-height: 1;">`)
+		htmlBody.WriteString(fmt.Sprintf(`<span style="color: green;">✅ %-8s</span>: %s-%s %s`,
+			user.Login42,
+			user.FirstAccess.In(campusLoc).Format("15:04:05"),
+			user.LastAccess.In(campusLoc).Format("15:04:05"),
+			formatDuration(user.Duration),
+		))
+		htmlBody.WriteString(`</td></tr>`)
+	}
+	for _, user := range notSeen {
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-family: Menlo, Consolas, 'Courier New', monospace; font-size: 13px; padding: 1px 20px; line-height: 1;">`)
+		htmlBody.WriteString(fmt.Sprintf(`<span style="color: red;">❌ %-8s</span>: No badge used yet`, user.Login42))
+		htmlBody.WriteString(`</td></tr>`)
+	}
+	for _, user := range atCompany {
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-family: Menlo, Consolas, 'Courier New', monospace; font-size: 13px; padding: 1px 20px; line-height: 1;">`)
+		htmlBody.WriteString(fmt.Sprintf(`<span style="color: #888;">🏢 %-8s</span>: At company today`, user.Login42))
+		htmlBody.WriteString(`</td></tr>`)
+	}
+	htmlBody.WriteString(`</table><p style="font-size:11px; color:#888;">Generated by Watchdog at ` + today.Format("15:04:05") + ` - Nothing was posted &nbsp;</p>`)
+	err := mailer.Send(campus.Recipients, fmt.Sprintf("Watchdog%s – Status Report - %s", campus.tag(), today.Format("02/01/2006")), htmlBody.String(), true)
+	if err != nil {
+		campus.Log(fmt.Sprintf("[WATCHDOG] [REPORT] ERROR: couldn't send status report: %s", err.Error()))
+		return
+	}
+	campus.Log(fmt.Sprintf("[WATCHDOG] [REPORT] 📨 Status report sent (%d seen, %d not seen, %d at company)", len(seen), len(notSeen), len(atCompany)))
+}
+
 func isProjectOngoing(login string, projectID string) bool {
 	resp, err := apiManager.GetClient(config.FTv2).Get(fmt.Sprintf("/users/%s/projects/%s/teams?sort=-created_at", login, projectID))
 	if err != nil {
@@ -452,191 +580,151 @@ func formatPostInfo(user User, loc *time.Location, msg string) string {
 		emoji = "❌"
 	}
 	return fmt.Sprintf(
-		"[WATCHDOG] [POST] ├── %s %-8s: %s %s %s — %s\n",
+		"[WATCHDOG] [POST] ├── %s %-8s: %s %s %s%s — %s\n",
 		emoji,
 		user.Login42,
 		first,
 		last,
 		formatDuration(user.Duration),
+		formatCredited(user),
 		msg,
 	)
 }
 
-func resetUserDuration(user User) {
+// formatCredited shows the credited duration next to the raw one, when attendance rules changed it
+func formatCredited(user User) string {
+	if user.Credited == user.Duration || (user.Credited == 0 && user.Status != NOTHING_CREDITED) {
+		return ""
+	}
+	return " → " + formatDuration(user.Credited) + " credited"
+}
+
+func (campus *Campus) resetUserDuration(user User) {
 	user.FirstAccess = time.Time{}
 	user.LastAccess = time.Time{}
 	user.Duration = 0
-	AllUsers[user.ControlAccessID] = user
+	user.Credited = 0
+	user.CreditedRanges = nil
+	user.Swipes = nil
+	campus.AllUsers[user.ControlAccessID] = user
+	campus.persistUser(user.ControlAccessID, user)
 }
 
-func SinglePostApprentice(user User) {
-	parisLoc, _ := time.LoadLocation("Europe/Paris")
+// singlePostApprentice posts the attendance of one user. The caller must hold timePeriodMutex and AllUsersMutex.
+func (campus *Campus) singlePostApprentice(user User) {
+	campusLoc := campus.Location
+	day := campus.periodDay(campus.currentTimePeriod, user.LastAccess)
 	defer func() {
-		resetUserDuration(user)
-		Log(formatPostInfo(user, parisLoc, user.Status))
+		campus.recordAttendances([]User{user}, campus.currentTimePeriod, day)
+		campus.resetUserDuration(user)
+		campus.Log(formatPostInfo(user, campusLoc, user.Status))
 	}()
+	attendances, postable := campus.classifyUser(&user, day)
+	if !postable {
+		return
+	}
+	if !config.ConfigData.Attendance42.AutoPost {
+		user.Status = POST_OFF
+		return
+	}
+	campus.postUserAttendances(&user, attendances)
+}
+
+// classifyUser sets the status of a user whose presence is being posted, at the end of a watch period or on demand.
+// It returns the attendances of the user, and false when there is nothing to post.
+func (campus *Campus) classifyUser(user *User, day time.Time) ([]APIAttendance, bool) {
 	if user.FirstAccess.IsZero() {
-		if user.IsApprentice {
+		if user.IsApprentice && expectedAt(user.Login42, day) == DAY_COMPANY {
+			user.Status = APPRENTICE_AT_COMPANY
+		} else if user.IsApprentice {
 			user.Status = APPRENTICE_NO_BADGE
 		} else {
 			user.Status = NO_BADGE
 		}
-		return
+		return nil, false
 	}
 
-	id42, _ := strconv.ParseInt(user.ID42, 10, 64)
-
-	if user.FirstAccess.Equal(user.LastAccess) {
+	if user.FirstAccess.Equal(user.LastAccess) || user.Duration == 0 {
 		if user.IsApprentice {
 			user.Status = APPRENTICE_BADGED_ONCE
 		} else {
 			user.Status = BADGED_ONCE
 		}
-		return
+		return nil, false
 	}
 
 	if !user.IsApprentice {
 		user.Status = NOT_APPRENTICE
-		return
+		return nil, false
 	}
 
-	if !config.ConfigData.Attendance42.AutoPost {
-		user.Status = POST_ERROR
-		user.Error = fmt.Errorf("AUTOPOST is off")
-		return
-	}
-
-	resp, err := apiManager.GetClient(config.FTAttendance).Post("/attendances", APIAttendance{
-		Begin_at:  user.FirstAccess.UTC().Format(time.RFC3339),
-		End_at:    user.LastAccess.UTC().Format(time.RFC3339),
-		Source:    "access-control",
-		Campus_id: 41,
-		User_id:   int(id42),
-	})
-
-	if err != nil {
-		user.Status = POST_ERROR
-		user.Error = err
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		user.Status = POST_ERROR
-		user.Error = fmt.Errorf("%s", resp.Status)
-		return
-	}
+	id42, _ := strconv.ParseInt(user.ID42, 10, 64)
+	return campus.userAttendances(user, int(id42)), true
+}
 
-	user.Status = POSTED
-	user.Error = nil
+// PostApprenticesAttendances posts the attendances of the running watch period
+func (campus *Campus) PostApprenticesAttendances() {
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+	campus.postApprenticesAttendances()
 }
 
-func PostApprenticesAttendances() {
-	parisLoc, _ := time.LoadLocation("Europe/Paris")
+// postApprenticesAttendances is PostApprenticesAttendances for callers already holding timePeriodMutex
+func (campus *Campus) postApprenticesAttendances() {
+	campusLoc := campus.Location
 	sortedUser := map[string][]User{}
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
-	total := len(AllUsers)
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
+	total := len(campus.AllUsers)
 	if total == 0 {
-		Log("[WATCHDOG] [POST] Posting Attendances: no users registered")
+		campus.Log("[WATCHDOG] [POST] Posting Attendances: no users registered")
 		return
 	}
-	for _, user := range AllUsers {
-		if user.FirstAccess.IsZero() {
-			if user.IsApprentice {
-				user.Status = APPRENTICE_NO_BADGE
+	day := campus.attendanceDay(campus.AllUsers, campus.currentTimePeriod)
+	for _, user := range campus.AllUsers {
+		attendances, postable := campus.classifyUser(&user, day)
+		if postable {
+			if !config.ConfigData.Attendance42.AutoPost {
+				user.Status = POST_OFF
 			} else {
-				user.Status = NO_BADGE
+				campus.postUserAttendances(&user, attendances)
 			}
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
 		}
-
-		id42, _ := strconv.ParseInt(user.ID42, 10, 64)
-
-		if user.FirstAccess.Equal(user.LastAccess) {
-			if user.IsApprentice {
-				user.Status = APPRENTICE_BADGED_ONCE
-			} else {
-				user.Status = BADGED_ONCE
-			}
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
-		}
-
-		if !user.IsApprentice {
-			user.Status = NOT_APPRENTICE
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
-		}
-
-		if !config.ConfigData.Attendance42.AutoPost {
-			user.Status = POST_OFF
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
-		}
-
-		resp, err := apiManager.GetClient(config.FTAttendance).Post("/attendances", APIAttendance{
-			Begin_at:  user.FirstAccess.UTC().Format(time.RFC3339),
-			End_at:    user.LastAccess.UTC().Format(time.RFC3339),
-			Source:    "access-control",
-			Campus_id: 41,
-			User_id:   int(id42),
-		})
-
-		if err != nil {
-			user.Status = POST_ERROR
-			user.Error = err
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			user.Status = POST_ERROR
-			user.Error = fmt.Errorf("%s", resp.Status)
-			sortedUser[user.Status] = append(sortedUser[user.Status], user)
-			resetUserDuration(user)
-			continue
-		}
-
-		user.Status = POSTED
-		user.Error = nil
 		sortedUser[user.Status] = append(sortedUser[user.Status], user)
-		resetUserDuration(user)
+		campus.resetUserDuration(user)
 	}
 
+	var processed []User
 	for status, users := range sortedUser {
 		sort.Slice(users, func(i, j int) bool {
 			return users[i].Login42 < users[j].Login42 // or .Login42, etc.
 		})
 		sortedUser[status] = users // update the map with the sorted slice
+		processed = append(processed, users...)
 	}
+	campus.recordAttendances(processed, campus.currentTimePeriod, day)
 
 	// LOG NON APPRENTICE USERS:
 
-	Log("[WATCHDOG] [POST] ┌─ Posting Attendances:")
+	campus.Log("[WATCHDOG] [POST] ┌─ Posting Attendances:")
 	if len(sortedUser[NO_BADGE]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Students: No badge used today")
+		campus.Log("[WATCHDOG] [POST] ├──────── Students: No badge used today")
 		for _, user := range sortedUser[NO_BADGE] {
-			Log(formatPostInfo(user, parisLoc, user.Status))
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
 		}
 	}
 
 	if len(sortedUser[BADGED_ONCE]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Students: Used badge only once")
+		campus.Log("[WATCHDOG] [POST] ├──────── Students: Used badge only once")
 		for _, user := range sortedUser[BADGED_ONCE] {
-			Log(formatPostInfo(user, parisLoc, user.Status))
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
 		}
 	}
 
 	if len(sortedUser[NOT_APPRENTICE]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Students: Not an apprentice")
+		campus.Log("[WATCHDOG] [POST] ├──────── Students: Not an apprentice")
 		for _, user := range sortedUser[NOT_APPRENTICE] {
-			Log(formatPostInfo(user, parisLoc, user.Status))
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
 		}
 	}
 
@@ -644,67 +732,96 @@ func PostApprenticesAttendances() {
 
 	var htmlBody strings.Builder
 	atLeastOneField := false
-	today := time.Now()
-	htmlBody.WriteString("<h2>Watchdog Daily Report – " + today.Format("02/01/2006") + "</h2>")
+	today := campus.now()
+	// Night periods are reported on the day they started
+	htmlBody.WriteString("<h2>Watchdog Daily Report" + campus.tag() + " – " + day.Format("02/01/2006") + "</h2>")
 	htmlBody.WriteString(`
 		<table style="border:2px solid #ccc; padding: 8px; border-collapse:collapse; background:#f9f9f9;">
 	`)
 	htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
 	if len(sortedUser[POSTED]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts")
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts")
 		for _, user := range sortedUser[POSTED] {
-			Log(formatPostInfo(user, parisLoc, user.Status))
-			addLogToMail(&htmlBody, user, parisLoc)
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
+			addLogToMail(&htmlBody, user, campusLoc)
 		}
 		htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
 		atLeastOneField = true
 	}
 
 	if len(sortedUser[POST_OFF]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts (off)")
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts (off)")
 		for _, user := range sortedUser[POST_OFF] {
-			Log(formatPostInfo(user, parisLoc, user.Status))
-			addLogToMail(&htmlBody, user, parisLoc)
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
+			addLogToMail(&htmlBody, user, campusLoc)
+		}
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
+	}
+
+	if len(sortedUser[ALREADY_POSTED]) > 0 {
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Already posted")
+		for _, user := range sortedUser[ALREADY_POSTED] {
+			campus.Log(formatPostInfo(user, campusLoc, user.Error.Error()))
+			addLogToMail(&htmlBody, user, campusLoc)
+		}
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
+	}
+
+	if len(sortedUser[NOTHING_CREDITED]) > 0 {
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Nothing to credit")
+		for _, user := range sortedUser[NOTHING_CREDITED] {
+			campus.Log(formatPostInfo(user, campusLoc, user.Status))
+			addLogToMail(&htmlBody, user, campusLoc)
 		}
 		htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
 	}
 
 	if len(sortedUser[POST_ERROR]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts errors")
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Posts errors")
 		for _, user := range sortedUser[POST_ERROR] {
-			Log(formatPostInfo(user, parisLoc, user.Error.Error()))
-			addLogToMail(&htmlBody, user, parisLoc)
+			campus.Log(formatPostInfo(user, campusLoc, user.Error.Error()))
+			addLogToMail(&htmlBody, user, campusLoc)
 		}
 		atLeastOneField = true
 	}
 
 	if len(sortedUser[APPRENTICE_BADGED_ONCE]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Apprentices: Used badge only once")
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: Used badge only once")
 		for _, user := range sortedUser[APPRENTICE_BADGED_ONCE] {
-			Log(formatPostInfo(user, parisLoc, "Used badge only once"))
-			addLogToMail(&htmlBody, user, parisLoc)
+			campus.Log(formatPostInfo(user, campusLoc, "Used badge only once"))
+			addLogToMail(&htmlBody, user, campusLoc)
 		}
 		atLeastOneField = true
 	}
 
 	if len(sortedUser[APPRENTICE_NO_BADGE]) > 0 {
-		Log("[WATCHDOG] [POST] ├──────── Apprentices: No badge used today")
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: No badge used today")
 		for _, user := range sortedUser[APPRENTICE_NO_BADGE] {
-			Log(formatPostInfo(user, parisLoc, "No badge used today"))
-			addLogToMail(&htmlBody, user, parisLoc)
+			campus.Log(formatPostInfo(user, campusLoc, "No badge used today"))
+			addLogToMail(&htmlBody, user, campusLoc)
 		}
 		atLeastOneField = true
 	}
+
+	if len(sortedUser[APPRENTICE_AT_COMPANY]) > 0 {
+		campus.Log("[WATCHDOG] [POST] ├──────── Apprentices: At company today")
+		htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
+		for _, user := range sortedUser[APPRENTICE_AT_COMPANY] {
+			campus.Log(formatPostInfo(user, campusLoc, "At company today"))
+			addLogToMail(&htmlBody, user, campusLoc)
+		}
+	}
 	htmlBody.WriteString(`<tr><td style="white-space: pre; font-size: 13px; padding: 1px; padding-left: 20px; padding-right: 20px; line-height: 1;">  </td></tr>`)
-	htmlBody.WriteString(`</table><p style="font-size:11px; color:#888;">Generated by Watchdog at ` + today.Format("15:04:05") + ` - Timezone is CEST &nbsp;</p>`)
-	if atLeastOneField {
-		mailer.Send(mailer.GetRecipients(), fmt.Sprintf("Watchdog – Daily Report - %s", time.Now().Format("02/01/2006")), htmlBody.String(), true)
+	htmlBody.WriteString(`</table><p style="font-size:11px; color:#888;">Generated by Watchdog at ` + today.Format("15:04:05") + ` - Timezone is ` + campus.Timezone + ` &nbsp;</p>`)
+	if atLeastOneField && mailReports {
+		mailer.Send(campus.Recipients, fmt.Sprintf("Watchdog%s – Daily Report - %s", campus.tag(), day.Format("02/01/2006")), htmlBody.String(), true)
 	}
 
-	for key, user := range AllUsers {
+	for key, user := range campus.AllUsers {
 		user.Error = nil
-		AllUsers[key] = user
+		campus.AllUsers[key] = user
 	}
+	campus.saveStateSnapshot()
 }
 
 func addLogToMail(htmlBody *strings.Builder, user User, loc *time.Location) {
@@ -745,77 +862,97 @@ func addLogToMail(htmlBody *strings.Builder, user User, loc *time.Location) {
 		durationColor = "orange"
 	}
 
-	if user.Status != POSTED && user.Status != POST_OFF {
+	if user.Status != POSTED && user.Status != POST_OFF && user.Status != ALREADY_POSTED && user.Status != NOTHING_CREDITED {
 		color = "red"
 		firstColor = "red"
 		lastColor = "red"
 		emoji = "❌"
 		durationColor = "red"
 	}
+	if user.Status == APPRENTICE_AT_COMPANY {
+		color = "#888"
+		firstColor = "#888"
+		lastColor = "#888"
+		emoji = "🏢"
+		durationColor = "#888"
+	}
 
 	htmlBody.WriteString(`<tr><td style="white-space: pre; font-family: Menlo, Consolas, 'Courier New', monospace; font-size: 13px; padding: 1px 20px; line-height: 1;">`)
 	htmlBody.WriteString(`<span style="color: green;">` + emoji + `</span> `)
 	htmlBody.WriteString(`<span style="color:` + color + `;">` + fmt.Sprintf("%-8s", user.Login42) + `</span>: `)
 	htmlBody.WriteString(`<span style="color:` + firstColor + `;">` + firstFormated + `</span>-`)
 	htmlBody.WriteString(`<span style="color:` + lastColor + `;">` + lastFormated + `</span> `)
-	htmlBody.WriteString(`<span style="color:` + durationColor + `;">` + formatDuration(user.Duration) + `</span> — `)
+	htmlBody.WriteString(`<span style="color:` + durationColor + `;">` + formatDuration(user.Duration) + `</span>`)
+	if credited := formatCredited(user); credited != "" {
+		htmlBody.WriteString(`<span style="color: #888;">` + credited + `</span>`)
+	}
+	htmlBody.WriteString(` — `)
+	if segments := userSegments(user); len(segments) > 1 {
+		htmlBody.WriteString(`<span style="color: #888;">` + fmt.Sprintf("on site %s", formatSegments(segments, loc)) + `</span> — `)
+	}
 	htmlBody.WriteString(`<span style="color:` + color + `;">` + msg + `</span>`)
 	htmlBody.WriteString(`</td></tr>`)
 }
 
-func DeleteAllPisciners() {
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) DeleteAllPisciners() {
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	for id, user := range AllUsers {
+	for id, user := range campus.AllUsers {
 		if user.Profile == Pisciner {
-			delete(AllUsers, id)
-			Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted pisciner %s from Watchdog", user.Login42))
+			delete(campus.AllUsers, id)
+			campus.persistDelete(id)
+			campus.Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted pisciner %s from Watchdog", user.Login42))
 		}
 	}
 }
 
-func DeleteStudent(login string, withPost bool) {
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) DeleteStudent(login string, withPost bool) {
+	// The post reads the running watch period
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	for id, user := range AllUsers {
+	for id, user := range campus.AllUsers {
 		if strings.EqualFold(user.Login42, login) {
 			if withPost {
-				SinglePostApprentice(user)
+				campus.singlePostApprentice(user)
 			}
-			delete(AllUsers, id)
+			delete(campus.AllUsers, id)
+			campus.persistDelete(id)
 			if withPost {
-				Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted user %s from Watchdog with Post", user.Login42))
+				campus.Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted user %s from Watchdog with Post", user.Login42))
 			} else {
-				Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted user %s from Watchdog", user.Login42))
+				campus.Log(fmt.Sprintf("[WATCHDOG] 🗑️  Deleted user %s from Watchdog", user.Login42))
 			}
 			return
 		}
 	}
-	Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not delete user with login %s: user not found", login))
+	campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not delete user with login %s: user not found", login))
 }
 
-func UpdateStudent(login string, status bool) {
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) UpdateStudent(login string, status bool) {
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	for id, user := range AllUsers {
+	for id, user := range campus.AllUsers {
 		if strings.EqualFold(user.Login42, login) {
 			user.IsApprentice = status
-			AllUsers[id] = user
-			Log(fmt.Sprintf("[WATCHDOG] 🔧 Manually updated %s to apprentice=%t", user.Login42, status))
+			campus.AllUsers[id] = user
+			campus.persistUser(id, user)
+			campus.Log(fmt.Sprintf("[WATCHDOG] 🔧 Manually updated %s to apprentice=%t", user.Login42, status))
 			return
 		}
 	}
-	Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not update user with login %s: user not found", login))
+	campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not update user with login %s: user not found", login))
 }
 
-func RefetchStudent(login string) {
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) RefetchStudent(login string) {
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	for id, user := range AllUsers {
+	for id, user := range campus.AllUsers {
 		if strings.EqualFold(user.Login42, login) {
 			oldStatus := user.IsApprentice
 			user.IsApprentice = false
@@ -825,21 +962,22 @@ func RefetchStudent(login string) {
 					break
 				}
 			}
-			AllUsers[id] = user
-			Log(fmt.Sprintf("[WATCHDOG] 🔄 Refetched status for %s: %t → %t", user.Login42, oldStatus, user.IsApprentice))
+			campus.AllUsers[id] = user
+			campus.persistUser(id, user)
+			campus.Log(fmt.Sprintf("[WATCHDOG] 🔄 Refetched status for %s: %t → %t", user.Login42, oldStatus, user.IsApprentice))
 			return
 		}
 	}
 
-	Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not find user with login %s to refetch status", login))
+	campus.Log(fmt.Sprintf("[WATCHDOG] ⚠️  Could not find user with login %s to refetch status", login))
 }
 
-func RefetchAllStudents() {
-	Log("[WATCHDOG] 🔁 Refetching apprentice status for all users...")
-	AllUsersMutex.Lock()
-	defer AllUsersMutex.Unlock()
+func (campus *Campus) RefetchAllStudents() {
+	campus.Log("[WATCHDOG] 🔁 Refetching apprentice status for all users...")
+	campus.AllUsersMutex.Lock()
+	defer campus.AllUsersMutex.Unlock()
 
-	for id, user := range AllUsers {
+	for id, user := range campus.AllUsers {
 		oldStatus := user.IsApprentice
 		user.IsApprentice = false
 		for _, projectID := range config.ConfigData.ApiV2.ApprenticeProjects {
@@ -848,11 +986,12 @@ func RefetchAllStudents() {
 				break
 			}
 		}
-		AllUsers[id] = user
+		campus.AllUsers[id] = user
+		campus.persistUser(id, user)
 		if oldStatus != user.IsApprentice {
-			Log(fmt.Sprintf("[WATCHDOG] 🔄 Updated %s: %t → %t", user.Login42, oldStatus, user.IsApprentice))
+			campus.Log(fmt.Sprintf("[WATCHDOG] 🔄 Updated %s: %t → %t", user.Login42, oldStatus, user.IsApprentice))
 		}
 	}
 
-	Log("[WATCHDOG] ✅ All users' apprentice statuses have been refreshed")
+	campus.Log("[WATCHDOG] ✅ All users' apprentice statuses have been refreshed")
 }
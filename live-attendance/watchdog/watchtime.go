@@ -0,0 +1,208 @@
+package watchdog
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	BOUND_INCLUSIVE string = "inclusive"
+	BOUND_EXCLUSIVE string = "exclusive"
+)
+
+// A badge at the exact start of a period is counted by default, one at its exact end isn't
+var periodStartInclusive = true
+var periodEndInclusive = false
+
+func parseBound(name string, value string, fallback bool) (bool, error) {
+	switch value {
+	case "":
+		return fallback, nil
+	case BOUND_INCLUSIVE:
+		return true, nil
+	case BOUND_EXCLUSIVE:
+		return false, nil
+	}
+	return fallback, fmt.Errorf("invalid watchtimeBounds.%s `%s` (expected %s or %s)", name, value, BOUND_INCLUSIVE, BOUND_EXCLUSIVE)
+}
+
+func initWatchtimeBounds(start string, end string) error {
+	var err error
+	if periodStartInclusive, err = parseBound("start", start, true); err != nil {
+		return err
+	}
+	if periodEndInclusive, err = parseBound("end", end, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// crossesMidnight tells if the period ends on the day after it started, like 20:00:00 -> 02:00:00
+func (period TimePeriod) crossesMidnight() bool {
+	return AfterTime(period.StartingTime, period.EndingTime)
+}
+
+// occurrence returns the start and end of the period starting on the given day, in the timezone of day.
+// day must be on campus time.
+func (period TimePeriod) occurrence(day time.Time) (time.Time, time.Time) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), period.StartingTime.Hour(), period.StartingTime.Minute(), period.StartingTime.Second(), 0, day.Location())
+	end := time.Date(day.Year(), day.Month(), day.Day(), period.EndingTime.Hour(), period.EndingTime.Minute(), period.EndingTime.Second(), 0, day.Location())
+	if period.crossesMidnight() {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// bounds returns the start and end of the period occurrence timeStamp belongs to.
+// A night period is attributed to the day it started, so its after midnight part belongs to the day before.
+// timeStamp must be on campus time.
+func (period TimePeriod) bounds(timeStamp time.Time) (time.Time, time.Time) {
+	if period.crossesMidnight() && BeforeTime(timeStamp, period.StartingTime) {
+		return period.occurrence(timeStamp.AddDate(0, 0, -1))
+	}
+	return period.occurrence(timeStamp)
+}
+
+// lastNight returns the last period of a day if it crosses midnight
+func lastNight(periods []TimePeriod) *TimePeriod {
+	if len(periods) == 0 || !periods[len(periods)-1].crossesMidnight() {
+		return nil
+	}
+	return &periods[len(periods)-1]
+}
+
+func afterPeriodStart(timeStamp time.Time, period TimePeriod) bool {
+	if periodStartInclusive {
+		return !BeforeTime(timeStamp, period.StartingTime)
+	}
+	return AfterTime(timeStamp, period.StartingTime)
+}
+
+func beforePeriodEnd(timeStamp time.Time, period TimePeriod) bool {
+	if periodEndInclusive {
+		return !AfterTime(timeStamp, period.EndingTime)
+	}
+	return BeforeTime(timeStamp, period.EndingTime)
+}
+
+func (campus *Campus) getCurrentTimePeriod() *TimePeriod {
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+	return campus.currentTimePeriod
+}
+
+func (campus *Campus) isWatchtimeSchedulerRunning() bool {
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+	return campus.watchtimeSchedulerRunning
+}
+
+// updateTimePeriod closes the current watch period and opens the one containing timeStamp, if they differ.
+// Closing a period posts its attendances. With the watchtime scheduler, listening follows the watch periods.
+func (campus *Campus) updateTimePeriod(timeStamp time.Time) {
+	campus.timePeriodMutex.Lock()
+	defer campus.timePeriodMutex.Unlock()
+
+	isInWatchtime := campus.getTimePeriodForTimeStamp(timeStamp)
+	if isInWatchtime == campus.currentTimePeriod {
+		return
+	}
+	if isInWatchtime != nil {
+		campus.Log(fmt.Sprintf("[WATCHDOG] 🕓 Watchtime changed: [%s - %s]", (*isInWatchtime).StartingTime.Format("15:04:05"), (*isInWatchtime).EndingTime.Format("15:04:05")))
+	} else if closure, closed := campus.closureOn(timeStamp.In(campus.Location)); closed && campus.findTimePeriod(timeStamp) != nil {
+		campus.Log(fmt.Sprintf("[WATCHDOG] 🕓 Watchtime changed: Watchdog went to sleep, campus is closed (%s)", closure.Reason))
+	} else {
+		campus.Log("[WATCHDOG] 🕓 Watchtime changed: Watchdog went to sleep")
+	}
+	if campus.currentTimePeriod != nil {
+		campus.postApprenticesAttendances()
+	}
+	campus.currentTimePeriod = isInWatchtime
+	// Replay only knows users from its events, don't mix them with the live roster
+	if campus.watchtimeSchedulerRunning {
+		campus.AllowEvents(isInWatchtime != nil)
+		if isInWatchtime != nil {
+			go campus.LoadRoster()
+		}
+	}
+}
+
+// nextWatchtimeBoundary returns the first period start or end strictly after from.
+// Returns a zero time if no watch period is configured.
+func (campus *Campus) nextWatchtimeBoundary(from time.Time) time.Time {
+	from = from.In(campus.Location)
+	var next time.Time
+	// Start from yesterday, its night period may end today
+	for offset := -1; offset <= 7; offset++ {
+		day := from.AddDate(0, 0, offset)
+		for _, period := range campus.periodsOn(day) {
+			start, end := period.occurrence(day)
+			for _, boundary := range []time.Time{start, end} {
+				if boundary.After(from) && (next.IsZero() || boundary.Before(next)) {
+					next = boundary
+				}
+			}
+		}
+		if !next.IsZero() && offset >= 0 {
+			return next
+		}
+	}
+	return next
+}
+
+func (campus *Campus) runWatchtimeScheduler(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		campus.updateTimePeriod(campus.now())
+		next := campus.nextWatchtimeBoundary(campus.now())
+		if next.IsZero() {
+			// Dated overrides may add periods later on, look again tomorrow
+			next = campus.now().Add(24 * time.Hour)
+			campus.Log("[WATCHDOG] ⏰ No watch period in the coming week")
+		} else {
+			campus.Log(fmt.Sprintf("[WATCHDOG] ⏰ Next watchtime change at %s", next.Format("02/01/2006 15:04:05")))
+		}
+		// Wake up once the boundary is passed, so the change is seen with both bound semantics.
+		// Watchtime overrides wake it up earlier.
+		timer := time.NewTimer(time.Until(next.Add(time.Second)))
+		select {
+		case <-timer.C:
+		case <-campus.watchtimeChanged:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// StartWatchtimeScheduler opens and closes watch periods on time, even if no badge event comes in.
+// Events are accepted while a watch period is running, start_listen and stop_listen change that until the next period change.
+func StartWatchtimeScheduler() {
+	for _, campus := range Campuses {
+		campus.timePeriodMutex.Lock()
+		// A period resumed from the state store is listened to right away
+		campus.AllowEvents(campus.currentTimePeriod != nil)
+		campus.watchtimeSchedulerRunning = true
+		campus.watchtimeSchedulerStop = make(chan struct{})
+		campus.watchtimeSchedulerDone = make(chan struct{})
+		go campus.runWatchtimeScheduler(campus.watchtimeSchedulerStop, campus.watchtimeSchedulerDone)
+		campus.timePeriodMutex.Unlock()
+	}
+}
+
+// StopWatchtimeScheduler stops the watchtime schedulers and waits for them, no watch period is closed afterwards
+func StopWatchtimeScheduler() {
+	for _, campus := range Campuses {
+		campus.timePeriodMutex.Lock()
+		if !campus.watchtimeSchedulerRunning {
+			campus.timePeriodMutex.Unlock()
+			continue
+		}
+		campus.watchtimeSchedulerRunning = false
+		close(campus.watchtimeSchedulerStop)
+		done := campus.watchtimeSchedulerDone
+		campus.timePeriodMutex.Unlock()
+		<-done
+	}
+}
@@ -0,0 +1,184 @@
+package watchdog
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"watchdog/config"
+)
+
+func loadParis(t *testing.T) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no timezone database: %s", err)
+	}
+	return location
+}
+
+func clock(value string) time.Time {
+	parsed, _ := time.Parse("15:04:05", value)
+	return parsed
+}
+
+func period(start, end string) TimePeriod {
+	return TimePeriod{StartingTime: clock(start), EndingTime: clock(end)}
+}
+
+func TestOccurrence(t *testing.T) {
+	paris := loadParis(t)
+	local := func(value string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", value, paris)
+		return parsed
+	}
+	tests := []struct {
+		name      string
+		period    TimePeriod
+		day       string
+		wantStart string
+		wantEnd   string
+	}{
+		{name: "day period", period: period("08:00:00", "18:00:00"), day: "2026-10-15 00:00", wantStart: "2026-10-15 08:00", wantEnd: "2026-10-15 18:00"},
+		{name: "night period ends the next day", period: period("20:00:00", "02:00:00"), day: "2026-10-15 00:00", wantStart: "2026-10-15 20:00", wantEnd: "2026-10-16 02:00"},
+		{name: "night period over the end of the month", period: period("22:00:00", "01:00:00"), day: "2026-10-31 12:00", wantStart: "2026-10-31 22:00", wantEnd: "2026-11-01 01:00"},
+		{name: "night period over a DST change", period: period("20:00:00", "02:00:00"), day: "2026-10-24 00:00", wantStart: "2026-10-24 20:00", wantEnd: "2026-10-25 02:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := test.period.occurrence(local(test.day))
+			if !start.Equal(local(test.wantStart)) || !end.Equal(local(test.wantEnd)) {
+				t.Fatalf("occurrence() = %s -> %s, want %s -> %s", start, end, test.wantStart, test.wantEnd)
+			}
+		})
+	}
+	// Clocks go back an hour in the night of 2026-10-25 in Paris
+	start, end := period("20:00:00", "02:00:00").occurrence(local("2026-10-24 00:00"))
+	if end.Sub(start) != 7*time.Hour {
+		t.Fatalf("night period over a DST change lasts %s, want 7h", end.Sub(start))
+	}
+}
+
+func TestBounds(t *testing.T) {
+	paris := loadParis(t)
+	local := func(value string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", value, paris)
+		return parsed
+	}
+	tests := []struct {
+		name      string
+		period    TimePeriod
+		timeStamp string
+		wantStart string
+		wantEnd   string
+	}{
+		{name: "day period", period: period("08:00:00", "18:00:00"), timeStamp: "2026-10-15 10:00", wantStart: "2026-10-15 08:00", wantEnd: "2026-10-15 18:00"},
+		{name: "night period before midnight", period: period("20:00:00", "02:00:00"), timeStamp: "2026-10-15 23:00", wantStart: "2026-10-15 20:00", wantEnd: "2026-10-16 02:00"},
+		{name: "night period after midnight belongs to the day before", period: period("20:00:00", "02:00:00"), timeStamp: "2026-10-16 01:00", wantStart: "2026-10-15 20:00", wantEnd: "2026-10-16 02:00"},
+		{name: "night period at its start", period: period("20:00:00", "02:00:00"), timeStamp: "2026-10-15 20:00", wantStart: "2026-10-15 20:00", wantEnd: "2026-10-16 02:00"},
+		{name: "night period after midnight of the 1st", period: period("22:00:00", "01:00:00"), timeStamp: "2026-11-01 00:30", wantStart: "2026-10-31 22:00", wantEnd: "2026-11-01 01:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := test.period.bounds(local(test.timeStamp))
+			if !start.Equal(local(test.wantStart)) || !end.Equal(local(test.wantEnd)) {
+				t.Fatalf("bounds() = %s -> %s, want %s -> %s", start, end, test.wantStart, test.wantEnd)
+			}
+		})
+	}
+}
+
+func TestValidatePeriods(t *testing.T) {
+	night := period("20:00:00", "02:00:00")
+	tests := []struct {
+		name          string
+		periods       []TimePeriod
+		previousNight *TimePeriod
+		want          []TimePeriod
+		wantDiscarded int
+	}{
+		{
+			name:    "sorted by start",
+			periods: []TimePeriod{period("13:00:00", "18:00:00"), period("08:00:00", "12:00:00")},
+			want:    []TimePeriod{period("08:00:00", "12:00:00"), period("13:00:00", "18:00:00")},
+		},
+		{
+			name:    "night period last",
+			periods: []TimePeriod{period("20:00:00", "02:00:00"), period("08:00:00", "12:00:00")},
+			want:    []TimePeriod{period("08:00:00", "12:00:00"), period("20:00:00", "02:00:00")},
+		},
+		{
+			name:          "overlapping periods",
+			periods:       []TimePeriod{period("08:00:00", "14:00:00"), period("13:00:00", "18:00:00")},
+			want:          []TimePeriod{period("08:00:00", "14:00:00")},
+			wantDiscarded: 1,
+		},
+		{
+			name:          "only the last period can cross midnight",
+			periods:       []TimePeriod{period("20:00:00", "02:00:00"), period("22:00:00", "23:00:00")},
+			want:          []TimePeriod{period("20:00:00", "02:00:00")},
+			wantDiscarded: 1,
+		},
+		{
+			name:          "start equal to end",
+			periods:       []TimePeriod{period("08:00:00", "08:00:00")},
+			wantDiscarded: 1,
+		},
+		{
+			name:          "overlapping the night period of the day before",
+			periods:       []TimePeriod{period("01:00:00", "04:00:00"), period("08:00:00", "12:00:00")},
+			previousNight: &night,
+			want:          []TimePeriod{period("08:00:00", "12:00:00")},
+			wantDiscarded: 1,
+		},
+		{
+			name:          "starting when the night period of the day before ends",
+			periods:       []TimePeriod{period("02:00:00", "04:00:00")},
+			previousNight: &night,
+			want:          []TimePeriod{period("02:00:00", "04:00:00")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, discarded := validatePeriods(test.periods, test.previousNight)
+			if !slices.Equal(got, test.want) || len(discarded) != test.wantDiscarded {
+				t.Fatalf("validatePeriods() = %v, %v, want %v with %d discarded", got, discarded, test.want, test.wantDiscarded)
+			}
+		})
+	}
+}
+
+func TestEventDay(t *testing.T) {
+	paris := loadParis(t)
+	local := func(value string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", value, paris)
+		return parsed
+	}
+	// 2026-10-15 is a Thursday
+	tests := []struct {
+		name      string
+		timeStamp string
+		closed    string
+		want      string
+	}{
+		{name: "day period", timeStamp: "2026-10-15 10:00", want: "2026-10-15 08:00"},
+		{name: "end of the day period is outside", timeStamp: "2026-10-15 12:00", want: "2026-10-15 12:00"},
+		{name: "night period before midnight", timeStamp: "2026-10-15 23:30", want: "2026-10-15 20:00"},
+		{name: "night period after midnight", timeStamp: "2026-10-16 01:30", want: "2026-10-15 20:00"},
+		{name: "after the night period", timeStamp: "2026-10-16 02:30", want: "2026-10-16 02:30"},
+		{name: "night period of a closed day", timeStamp: "2026-10-16 01:30", closed: "2026-10-15", want: "2026-10-16 01:30"},
+		{name: "closed the day after the night period started", timeStamp: "2026-10-16 01:30", closed: "2026-10-16", want: "2026-10-15 20:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			campus := newCampus(config.ConfigCampus{Name: "test", Location: paris})
+			campus.watchtime[time.Thursday] = []TimePeriod{period("08:00:00", "12:00:00"), period("20:00:00", "02:00:00")}
+			if test.closed != "" {
+				campus.closures[test.closed] = Closure{Date: test.closed}
+			}
+			got := campus.EventDay(local(test.timeStamp))
+			if !got.Equal(local(test.want)) {
+				t.Fatalf("EventDay() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}